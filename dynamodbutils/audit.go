@@ -0,0 +1,298 @@
+package dynamodbutils
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// auditFields holds the names of the audit attributes of an item type and the types of their fields.
+// The names are empty for the attributes the type does not have.
+//
+// The audit attributes are declared with the 'dynamodbutils' tag:
+//   - `dynamodbutils:"createdAt"`: set by PutItem when the item is created and kept when it is replaced,
+//     unless the item written has it set already.
+//   - `dynamodbutils:"updatedAt"`: set by PutItem, UpdateItem and SoftDelete on every write.
+//   - `dynamodbutils:"deletedAt"`: set by SoftDelete. The items having it are ignored by GetItem,
+//     FindOneFromIndex, BatchGetItem and Query unless ReadOptions.IncludeDeleted or
+//     KeyCondition.IncludeDeleted is set, and always by Scan, ExecuteStatement and BatchExecuteStatement.
+//
+// The fields may be of the types time.Time, string (RFC3339) or int64 (unix epoch seconds), or pointers to them.
+type auditFields struct {
+	CreatedAt      string
+	CreatedAtType  reflect.Type
+	CreatedAtIndex []int
+	UpdatedAt      string
+	UpdatedAtType  reflect.Type
+	DeletedAt      string
+	DeletedAtType  reflect.Type
+}
+
+func (a auditFields) names() []string {
+	names := []string{}
+	for _, name := range []string{a.CreatedAt, a.UpdatedAt, a.DeletedAt} {
+		if len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// auditFieldsOf finds the audit attributes of a type. Pointers and slices are followed to their element type.
+func auditFieldsOf(t reflect.Type) (fields auditFields) {
+	if t == nil {
+		return fields
+	}
+
+	for _, field := range structFields(t) {
+		switch {
+		case field.hasOption("createdAt"):
+			fields.CreatedAt, fields.CreatedAtType, fields.CreatedAtIndex = field.Name, field.Type, field.Index
+		case field.hasOption("updatedAt"):
+			fields.UpdatedAt, fields.UpdatedAtType = field.Name, field.Type
+		case field.hasOption("deletedAt"):
+			fields.DeletedAt, fields.DeletedAtType = field.Name, field.Type
+		}
+	}
+
+	return fields
+}
+
+var registeredAuditFields = make(map[string]auditFields)
+var registeredAuditFieldsMutex sync.RWMutex
+
+// RegisterAuditFields tells UpdateItem and SoftDelete which are the audit attributes of the items of a table,
+// taking them from the tags of the model's fields. PutItem and the reads find the audit attributes on the
+// items themselves and do not need the registration.
+//
+// Example:
+//
+//	type Order struct {
+//	    Id        string
+//	    CreatedAt time.Time  `dynamodbutils:"createdAt"`
+//	    UpdatedAt time.Time  `dynamodbutils:"updatedAt"`
+//	    DeletedAt *time.Time `dynamodbutils:"deletedAt" dynamodbav:",omitempty"`
+//	}
+//
+// err := RegisterAuditFields("Orders", Order{})
+func RegisterAuditFields(tablename string, model interface{}) error {
+	fields := auditFieldsOf(reflect.TypeOf(model))
+	if len(fields.names()) == 0 {
+		return errors.New("dynamodbutils.RegisterAuditFields: the model has no fields tagged as createdAt, updatedAt or deletedAt")
+	}
+
+	registeredAuditFieldsMutex.Lock()
+	defer registeredAuditFieldsMutex.Unlock()
+
+	registeredAuditFields[tablename] = fields
+
+	return nil
+}
+
+func auditFieldsOfTable(tablename string) auditFields {
+	registeredAuditFieldsMutex.RLock()
+	defer registeredAuditFieldsMutex.RUnlock()
+
+	return registeredAuditFields[tablename]
+}
+
+// SoftDelete marks an item as deleted, setting its deletedAt attribute (and its updatedAt attribute, if it has one)
+// to the current time. The table's audit attributes must have been registered with RegisterAuditFields.
+// The item must exist: SoftDelete does not create it, failing with ConditionalCheckFailedException instead.
+//
+// The errors returned are:
+//   - ConditionalCheckFailedException: the item does not exist.
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/dynamodb/#DynamoDB.UpdateItem
+func SoftDelete(tablename string, key Key) error {
+	fields := auditFieldsOfTable(tablename)
+	if len(fields.DeletedAt) == 0 {
+		return errors.New("dynamodbutils.SoftDelete: no deletedAt attribute was registered for the table " + tablename)
+	}
+
+	deletedAt, err := auditTimestamp(fields.DeletedAtType, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return UpdateItem(tablename, key, map[string]interface{}{fields.DeletedAt: rawAttribute{deletedAt}})
+}
+
+// auditTimestamp converts the given time to the format of an audit field of type 't'.
+func auditTimestamp(t reflect.Type, now time.Time) (*dynamodb.AttributeValue, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	now = now.UTC()
+
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return marshalingOptions.encodeTime(now), nil
+	case t.Kind() == reflect.String:
+		return &dynamodb.AttributeValue{S: aws.String(now.Format(time.RFC3339Nano))}, nil
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(now.Unix(), 10))}, nil
+	default:
+		return nil, errors.New("dynamodbutils: audit fields must be of type time.Time, string or integer, not " + t.String())
+	}
+}
+
+// applyAuditFields sets the createdAt and updatedAt attributes of an item being written by PutItem.
+// The createdAt attribute is set as if the item were new, unless the caller has set it: PutItem keeps
+// the existing value when the item is not new.
+func applyAuditFields(item interface{}, dynamoItem map[string]*dynamodb.AttributeValue, now time.Time) (err error) {
+	fields := auditFieldsOf(reflect.TypeOf(item))
+
+	if len(fields.CreatedAt) > 0 && !createdAtSupplied(item, fields) {
+		if dynamoItem[fields.CreatedAt], err = auditTimestamp(fields.CreatedAtType, now); err != nil {
+			return err
+		}
+	}
+
+	if len(fields.UpdatedAt) > 0 {
+		if dynamoItem[fields.UpdatedAt], err = auditTimestamp(fields.UpdatedAtType, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createdAtSupplied tells whether the createdAt field of an item being written was set by the caller.
+func createdAtSupplied(item interface{}, fields auditFields) bool {
+	if len(fields.CreatedAt) == 0 {
+		return false
+	}
+
+	v := reflect.ValueOf(item)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+
+	field, ok := fieldByIndex(v, fields.CreatedAtIndex)
+	return ok && !field.IsZero()
+}
+
+// isSoftDeleted tells whether an item has its deletedAt attribute set.
+func isSoftDeleted(item map[string]*dynamodb.AttributeValue, deletedAt string) bool {
+	if len(deletedAt) == 0 {
+		return false
+	}
+	attribute, ok := item[deletedAt]
+	return ok && attribute.NULL == nil
+}
+
+// notSoftDeletedCondition builds the filter that excludes the items having the deletedAt attribute set.
+func notSoftDeletedCondition(deletedAt string) Condition {
+	return Or(AttributeNotExists(deletedAt), function("attribute_type", deletedAt, "NULL"))
+}
+
+// maxKeepCreatedAtAttempts is how many times putItemKeepingCreatedAt reads the item again when it is changed
+// between the read of its createdAt attribute and the write.
+const maxKeepCreatedAtAttempts = 3
+
+// putItemKeepingCreatedAt writes an item whose createdAt attribute must be kept if it already exists.
+// PutItem cannot do it, so the current createdAt is read first and copied to the item, which then replaces
+// the existing one with a PutItem conditioned on createdAt not having changed meanwhile. If it changed, by
+// a concurrent write, the createdAt is read again.
+// An UpdateItem setting createdAt with if_not_exists would need a single request, but it cannot replace the
+// item: the attributes the new item does not have would be kept.
+// So each write costs a consistent GetItem more, which consumes read capacity for the whole item (the
+// projection does not reduce it) and adds the latency of a request. The key schema of the table is only
+// described on the first write.
+// It returns the attributes of the item replaced.
+func putItemKeepingCreatedAt(tablename string, item map[string]*dynamodb.AttributeValue, createdAt string, condition encodedCondition) (map[string]*dynamodb.AttributeValue, error) {
+	pkName, skName, err := tableKeyNames(tablename)
+	if err != nil {
+		return nil, err
+	}
+
+	keyAttributes, ok := extractKeyAttributes(item, pkName, skName)
+	if !ok {
+		return nil, errors.New("dynamodbutils.PutItem: the item does not have the key attributes of the table " + tablename)
+	}
+
+	svc := newClient()
+
+	// readCreatedAt tells whether the item exists and returns its createdAt attribute
+	readCreatedAt := func() (bool, *dynamodb.AttributeValue, error) {
+		output, err := svc.GetItem(&dynamodb.GetItemInput{
+			TableName:                aws.String(tablename),
+			Key:                      keyAttributes,
+			ConsistentRead:           aws.Bool(true),
+			ProjectionExpression:     aws.String("#pk, #createdAt"),
+			ExpressionAttributeNames: map[string]*string{"#pk": aws.String(pkName), "#createdAt": aws.String(createdAt)},
+		})
+		if err != nil {
+			return false, nil, err
+		}
+		return len(output.Item) > 0, output.Item[createdAt], nil
+	}
+
+	exists, currentCreatedAt, err := readCreatedAt()
+	if err != nil {
+		return nil, err
+	}
+
+	newCreatedAt := item[createdAt]
+
+	for attempt := 1; ; attempt++ {
+		// the item is written only if its createdAt is still the one read
+		var unchanged expression.ConditionBuilder
+		switch {
+		case !exists:
+			item[createdAt] = newCreatedAt
+			unchanged = expression.AttributeNotExists(expression.Name(pkName))
+		case currentCreatedAt == nil:
+			item[createdAt] = newCreatedAt
+			unchanged = expression.AttributeExists(expression.Name(pkName)).And(expression.AttributeNotExists(expression.Name(createdAt)))
+		default:
+			item[createdAt] = currentCreatedAt
+			unchanged = expression.Equal(expression.Name(createdAt), expression.Value(rawAttribute{currentCreatedAt}))
+		}
+
+		expr, err := expression.NewBuilder().WithCondition(unchanged).Build()
+		if err != nil {
+			return nil, err
+		}
+
+		names, values := mergePlaceholders(expr.Names(), expr.Values(), condition)
+
+		output, err := svc.PutItem(&dynamodb.PutItemInput{
+			TableName:                 aws.String(tablename),
+			Item:                      item,
+			ConditionExpression:       mergeExpression(expr.Condition(), condition.Expression),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+			ReturnValues:              aws.String(dynamodb.ReturnValueAllOld),
+		})
+		if err == nil {
+			return output.Attributes, nil
+		}
+
+		if !isConditionalCheckFailed(err) || attempt == maxKeepCreatedAtAttempts {
+			return nil, err
+		}
+
+		// the check failed either because of the given condition or because the item was changed after it
+		// was read: it is only written again in the second case
+		existsNow, createdAtNow, readErr := readCreatedAt()
+		if readErr != nil || (existsNow == exists && reflect.DeepEqual(createdAtNow, currentCreatedAt)) {
+			return nil, err
+		}
+
+		exists, currentCreatedAt = existsNow, createdAtNow
+	}
+}
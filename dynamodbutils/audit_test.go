@@ -0,0 +1,150 @@
+package dynamodbutils
+
+import (
+	"testing"
+	"time"
+)
+
+type AuditedCity struct {
+	State     string
+	Id        int
+	Name      string
+	CreatedAt time.Time  `dynamodbutils:"createdAt"`
+	UpdatedAt time.Time  `dynamodbutils:"updatedAt"`
+	DeletedAt *time.Time `dynamodbutils:"deletedAt" dynamodbav:",omitempty"`
+}
+
+func TestAuditFieldsAndSoftDelete(t *testing.T) {
+	check(RegisterAuditFields(tablename, AuditedCity{}))
+	defer func() {
+		registeredAuditFieldsMutex.Lock()
+		delete(registeredAuditFields, tablename)
+		registeredAuditFieldsMutex.Unlock()
+	}()
+
+	key := Key{PKName: "State", PKValue: "AUDIT", SKName: "Id", SKValue: 1}
+
+	check(PutItem(tablename, AuditedCity{State: "AUDIT", Id: 1, Name: "Created"}))
+
+	created := AuditedCity{}
+	check(GetItem(tablename, key, &created))
+
+	if created.CreatedAt.IsZero() || created.UpdatedAt.IsZero() {
+		t.Errorf("createdAt and updatedAt should have been set but got %+v", created)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	// replacing the item keeps its createdAt
+	check(PutItem(tablename, AuditedCity{State: "AUDIT", Id: 1, Name: "Replaced"}))
+
+	replaced := AuditedCity{}
+	check(GetItem(tablename, key, &replaced))
+
+	if !replaced.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("createdAt should have been kept as %v but was %v", created.CreatedAt, replaced.CreatedAt)
+	}
+	if !replaced.UpdatedAt.After(created.UpdatedAt) {
+		t.Errorf("updatedAt should be after %v but was %v", created.UpdatedAt, replaced.UpdatedAt)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	check(UpdateItem(tablename, key, map[string]interface{}{"Name": "Updated"}))
+
+	updated := AuditedCity{}
+	check(GetItem(tablename, key, &updated))
+
+	if !updated.UpdatedAt.After(replaced.UpdatedAt) {
+		t.Errorf("updatedAt should be after %v but was %v", replaced.UpdatedAt, updated.UpdatedAt)
+	}
+
+	check(SoftDelete(tablename, key))
+
+	err := GetItem(tablename, key, &AuditedCity{})
+	if err == nil || err.Error() != "ItemNotFoundException" {
+		t.Errorf("err should be 'ItemNotFoundException' but was '%v'", err)
+	}
+
+	deleted := AuditedCity{}
+	check(GetItemWithOptions(tablename, key, &deleted, ReadOptions{IncludeDeleted: true}))
+
+	if deleted.DeletedAt == nil {
+		t.Errorf("deletedAt should have been set but got %+v", deleted)
+	}
+
+	cities := []AuditedCity{}
+	check(Query(tablename, KeyCondition{PKName: "State", PKValue: "AUDIT"}, &cities))
+
+	if len(cities) != 0 {
+		t.Errorf("the deleted item should not be returned by Query but got %+v", cities)
+	}
+
+	check(Query(tablename, KeyCondition{PKName: "State", PKValue: "AUDIT", IncludeDeleted: true}, &cities))
+
+	if len(cities) != 1 {
+		t.Errorf("the deleted item should be returned by Query with IncludeDeleted but got %+v", cities)
+	}
+}
+
+func TestPutItemReplacesAuditedItem(t *testing.T) {
+	type AuditedPlace struct {
+		State     string
+		Id        int
+		Name      string
+		Nickname  string    `dynamodbav:",omitempty"`
+		CreatedAt time.Time `dynamodbutils:"createdAt"`
+	}
+
+	key := Key{PKName: "State", PKValue: "AUDIT-REPLACE", SKName: "Id", SKValue: 1}
+
+	check(PutItem(tablename, AuditedPlace{State: "AUDIT-REPLACE", Id: 1, Name: "Created", Nickname: "Old"}))
+
+	// the item is replaced as a whole: the attributes it no longer has are removed, even the ones the
+	// struct does not know about
+	check(PutItem(tablename, AuditedPlace{State: "AUDIT-REPLACE", Id: 1, Name: "Replaced"}))
+
+	replaced := map[string]interface{}{}
+	check(GetItem(tablename, key, &replaced))
+
+	if _, ok := replaced["Nickname"]; ok {
+		t.Errorf("Nickname should have been removed but the item is %v", replaced)
+	}
+
+	err := PutItemIf(tablename, AuditedPlace{State: "AUDIT-REPLACE", Id: 1, Name: "Conditional"}, Eq("Name", "Created"))
+	if !isConditionalCheckFailed(err) {
+		t.Errorf("err should be 'ConditionalCheckFailedException' but was '%v'", err)
+	}
+}
+
+func TestSoftDeleteRequiresTheItem(t *testing.T) {
+	check(RegisterAuditFields(tablename, AuditedCity{}))
+	defer func() {
+		registeredAuditFieldsMutex.Lock()
+		delete(registeredAuditFields, tablename)
+		registeredAuditFieldsMutex.Unlock()
+	}()
+
+	err := SoftDelete(tablename, Key{PKName: "State", PKValue: "AUDIT-MISSING", SKName: "Id", SKValue: 1})
+	if !isConditionalCheckFailed(err) {
+		t.Errorf("err should be 'ConditionalCheckFailedException' but was '%v'", err)
+	}
+}
+
+func TestPutItemKeepsTheCreatedAtSupplied(t *testing.T) {
+	key := Key{PKName: "State", PKValue: "AUDIT-SUPPLIED", SKName: "Id", SKValue: 1}
+	supplied := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	check(PutItem(tablename, AuditedCity{State: "AUDIT-SUPPLIED", Id: 1, Name: "Created"}))
+	check(PutItem(tablename, AuditedCity{State: "AUDIT-SUPPLIED", Id: 1, Name: "Migrated", CreatedAt: supplied}))
+
+	migrated := AuditedCity{}
+	check(GetItem(tablename, key, &migrated))
+
+	if !migrated.CreatedAt.Equal(supplied) {
+		t.Errorf("createdAt should have been written as %v but was %v", supplied, migrated.CreatedAt)
+	}
+	if migrated.UpdatedAt.IsZero() {
+		t.Errorf("updatedAt should have been set but got %+v", migrated)
+	}
+}
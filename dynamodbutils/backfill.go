@@ -0,0 +1,515 @@
+package dynamodbutils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// BackfillJob describes the backfill of the attributes of a global secondary index, see BackfillIndex.
+//   - TableName and IndexName: the table and the index being backfilled.
+//   - Compute: receives each item of the table and returns the attributes to be set on it, e.g. the key
+//     attributes of the index derived from the other attributes. Returning no attributes skips the item.
+//   - Segments: the number of segments of the parallel scan of the table. Default 1.
+//   - Overwrite: when true the attributes are set even if the item already has them with other values.
+//     By default only the missing attributes are set, so the values written by the application since
+//     the scan are kept.
+//   - MaxUpdatesPerSecond: the maximum rate of the updates, summing all the segments, so the backfill
+//     does not consume all the write capacity of the table. Default: no limit.
+//   - SampleSize: the number of items checked on the index after the backfill, see CheckIndex. Default 100.
+//     Use a negative value to skip the check.
+//   - OnProgress: called after each page of the scan, with the totals of the job.
+type BackfillJob struct {
+	TableName           string                                                            // mandatory
+	IndexName           string                                                            // mandatory
+	Compute             func(item map[string]interface{}) (map[string]interface{}, error) // mandatory
+	Segments            int                                                               // optional
+	Overwrite           bool                                                              // optional
+	MaxUpdatesPerSecond float64                                                           // optional
+	SampleSize          int                                                               // optional
+	OnProgress          func(BackfillProgress)                                            // optional
+}
+
+// BackfillProgress reports the progress of a backfill.
+//   - Scanned: the number of items read from the table.
+//   - Updated: the number of items updated.
+//   - Skipped: the number of items that did not need to be updated or that were changed or deleted
+//     concurrently, failing the condition of the update.
+type BackfillProgress struct {
+	Scanned int64
+	Updated int64
+	Skipped int64
+}
+
+// BackfillReport is the result of BackfillIndex: the totals of the backfill and the result of the check of the index.
+type BackfillReport struct {
+	BackfillProgress
+	Check IndexCheckReport
+}
+
+// IndexCheckReport is the result of CheckIndex.
+//   - Sampled: the number of items of the table checked.
+//   - Mismatches: the items whose attributes differ from the ones computed or that were not found on the index.
+type IndexCheckReport struct {
+	Sampled    int
+	Mismatches []IndexMismatch
+}
+
+// IndexMismatch describes an item of the table that does not have the attributes computed for it or that
+// was not found as expected on the index.
+//   - Key: the key of the item on the table.
+//   - Reason: the description of the problem.
+type IndexMismatch struct {
+	Key    map[string]interface{}
+	Reason string
+}
+
+// BackfillIndex scans a table, computes the attributes of the index of each item with the job's Compute
+// function, writes them back with conditional updates and then checks a sample of the items on the index
+// with CheckIndex. The scan stops at the first error returned by Compute or by dynamodb.
+//
+// The items encrypted with SetEncryption cannot be backfilled, since updating them would invalidate their
+// signature: the scan stops with an error on the first one found.
+//
+// Example:
+//
+//	report, err := BackfillIndex(ctx, BackfillJob{
+//	    TableName: "Orders",
+//	    IndexName: "CustomerOrders",
+//	    Compute: func(item map[string]interface{}) (map[string]interface{}, error) {
+//	        return map[string]interface{}{"CustomerId": item["Customer"].(map[string]interface{})["Id"]}, nil
+//	    },
+//	    Segments: 4,
+//	})
+func BackfillIndex(ctx context.Context, job BackfillJob) (BackfillReport, error) {
+	if job.Compute == nil {
+		return BackfillReport{}, errors.New("dynamodbutils.BackfillIndex: the Compute function is mandatory")
+	}
+
+	segments := job.Segments
+	if segments <= 0 {
+		segments = 1
+	}
+
+	pkName, skName, err := tableKeyNames(job.TableName)
+	if err != nil {
+		return BackfillReport{}, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	b := &backfill{job: job, pkName: pkName, skName: skName}
+
+	var wg sync.WaitGroup
+	errs := make([]error, segments)
+
+	for segment := 0; segment < segments; segment++ {
+		wg.Add(1)
+		go func(segment int) {
+			defer wg.Done()
+			if errs[segment] = b.scanSegment(ctx, segment, segments); errs[segment] != nil {
+				cancel()
+			}
+		}(segment)
+	}
+
+	wg.Wait()
+
+	report := BackfillReport{BackfillProgress: b.progress()}
+
+	for _, err := range errs {
+		if err != nil && err != context.Canceled {
+			return report, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+
+	if job.SampleSize >= 0 {
+		report.Check, err = CheckIndex(job)
+	}
+
+	return report, err
+}
+
+// backfill holds the state of a BackfillIndex job.
+type backfill struct {
+	job    BackfillJob
+	pkName string
+	skName string
+
+	scanned int64
+	updated int64
+	skipped int64
+
+	progressMutex sync.Mutex
+
+	// nextUpdate is the time of the next update allowed by MaxUpdatesPerSecond
+	nextUpdate time.Time
+	rateMutex  sync.Mutex
+}
+
+func (b *backfill) progress() BackfillProgress {
+	return BackfillProgress{
+		Scanned: atomic.LoadInt64(&b.scanned),
+		Updated: atomic.LoadInt64(&b.updated),
+		Skipped: atomic.LoadInt64(&b.skipped),
+	}
+}
+
+func (b *backfill) scanSegment(ctx context.Context, segment int, segments int) error {
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(b.job.TableName),
+	}
+	if segments > 1 {
+		input.Segment = aws.Int64(int64(segment))
+		input.TotalSegments = aws.Int64(int64(segments))
+	}
+
+	var err error
+
+	scanErr := newClient().ScanPagesWithContext(ctx, input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			if err = b.backfillItem(ctx, item); err != nil {
+				return false
+			}
+		}
+
+		if b.job.OnProgress != nil {
+			b.progressMutex.Lock()
+			b.job.OnProgress(b.progress())
+			b.progressMutex.Unlock()
+		}
+
+		return ctx.Err() == nil
+	})
+
+	if err != nil {
+		return err
+	}
+	if scanErr != nil {
+		return scanErr
+	}
+
+	return ctx.Err()
+}
+
+func (b *backfill) backfillItem(ctx context.Context, item map[string]*dynamodb.AttributeValue) error {
+	atomic.AddInt64(&b.scanned, 1)
+
+	if _, ok := item[encryptionAttributeName]; ok {
+		return errors.New("dynamodbutils.BackfillIndex: the table " + b.job.TableName + " has encrypted items, which cannot be updated without invalidating their signature")
+	}
+
+	decoded, err := decodeItem(b.job.TableName, item, false)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]interface{}{}
+	if err := unmarshalMap(decoded, &values); err != nil {
+		return err
+	}
+
+	attributes, err := b.job.Compute(values)
+	if err != nil {
+		return err
+	}
+
+	conditions := []Condition{}
+	changed := map[string]interface{}{}
+
+	for name, value := range attributes {
+		if _, ok := decoded[name]; ok && !b.job.Overwrite {
+			continue
+		}
+
+		changed[name] = value
+		if !b.job.Overwrite {
+			conditions = append(conditions, AttributeNotExists(name))
+		}
+	}
+
+	if len(changed) == 0 {
+		atomic.AddInt64(&b.skipped, 1)
+		return nil
+	}
+
+	key := Key{PKName: b.pkName, PKValue: rawAttribute{item[b.pkName]}}
+	if len(b.skName) > 0 {
+		key.SKName, key.SKValue = b.skName, rawAttribute{item[b.skName]}
+	}
+
+	if err := b.waitRate(ctx); err != nil {
+		return err
+	}
+
+	err = UpdateItemIf(b.job.TableName, key, changed, And(conditions...))
+
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		// the item was changed or deleted since it was read
+		atomic.AddInt64(&b.skipped, 1)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&b.updated, 1)
+
+	return nil
+}
+
+// waitRate waits for the turn of the next update, as limited by MaxUpdatesPerSecond.
+func (b *backfill) waitRate(ctx context.Context) error {
+	if b.job.MaxUpdatesPerSecond <= 0 {
+		return nil
+	}
+
+	b.rateMutex.Lock()
+	now := time.Now()
+	if b.nextUpdate.Before(now) {
+		b.nextUpdate = now
+	}
+	wait := b.nextUpdate.Sub(now)
+	b.nextUpdate = b.nextUpdate.Add(time.Duration(float64(time.Second) / b.job.MaxUpdatesPerSecond))
+	b.rateMutex.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	return sleep(ctx, wait)
+}
+
+// indexCheckRetryDelay is the time waited before checking again the items not found on the index, which is
+// updated asynchronously.
+var indexCheckRetryDelay = 2 * time.Second
+
+// CheckIndex checks a sample of the items of a table against one of its global secondary indexes, using
+// the TableName, IndexName, Compute and SampleSize (default 100) of the job. The items are read from a random
+// segment of the table and the attributes computed for each one by Compute are compared with the ones the
+// item has: the items whose attributes are missing or different are reported as mismatches. The items that
+// have the key attributes of the index are then queried on the index by their index key, as FindOneFromIndex
+// does, and reported as mismatches if they are not found. Since the indexes are updated asynchronously, the
+// items not found are checked once more after a short delay.
+//
+// Example:
+//
+// report, err := CheckIndex(job)
+func CheckIndex(job BackfillJob) (IndexCheckReport, error) {
+	if job.Compute == nil {
+		return IndexCheckReport{}, errors.New("dynamodbutils.CheckIndex: the Compute function is mandatory")
+	}
+
+	sampleSize := job.SampleSize
+	if sampleSize <= 0 {
+		sampleSize = 100
+	}
+
+	tablename, indexname := job.TableName, job.IndexName
+
+	description, err := describeTable(tablename)
+	if err != nil {
+		return IndexCheckReport{}, err
+	}
+
+	pkName, skName := keySchemaNames(description.KeySchema)
+
+	indexPKName, indexSKName := "", ""
+	for _, index := range description.GlobalSecondaryIndexes {
+		if aws.StringValue(index.IndexName) == indexname {
+			indexPKName, indexSKName = keySchemaNames(index.KeySchema)
+		}
+	}
+	if len(indexPKName) == 0 {
+		return IndexCheckReport{}, errors.New("dynamodbutils.CheckIndex: the table " + tablename + " has no global secondary index " + indexname)
+	}
+
+	sample, err := sampleItems(tablename, sampleSize)
+	if err != nil {
+		return IndexCheckReport{}, err
+	}
+
+	report := IndexCheckReport{Sampled: len(sample)}
+
+	addMismatch := func(item map[string]*dynamodb.AttributeValue, reason string) error {
+		keyAttributes, _ := extractKeyAttributes(item, pkName, skName)
+		key := map[string]interface{}{}
+		if err := unmarshalMap(keyAttributes, &key); err != nil {
+			return err
+		}
+		report.Mismatches = append(report.Mismatches, IndexMismatch{Key: key, Reason: reason})
+		return nil
+	}
+
+	indexed := []map[string]*dynamodb.AttributeValue{}
+
+	for _, item := range sample {
+		reason, err := computedMismatch(tablename, item, job.Compute)
+		if err != nil {
+			return report, err
+		}
+		if len(reason) > 0 {
+			if err := addMismatch(item, reason); err != nil {
+				return report, err
+			}
+			continue
+		}
+
+		_, hasPK := item[indexPKName]
+		_, hasSK := item[indexSKName]
+		if hasPK && (len(indexSKName) == 0 || hasSK) {
+			indexed = append(indexed, item)
+		}
+	}
+
+	missing := indexed
+	for attempt := 0; attempt < 2 && len(missing) > 0; attempt++ {
+		if attempt > 0 {
+			time.Sleep(indexCheckRetryDelay)
+		}
+
+		stillMissing := []map[string]*dynamodb.AttributeValue{}
+		for _, item := range missing {
+			found, err := isOnIndex(tablename, indexname, item, pkName, skName, indexPKName, indexSKName)
+			if err != nil {
+				return report, err
+			}
+			if !found {
+				stillMissing = append(stillMissing, item)
+			}
+		}
+		missing = stillMissing
+	}
+
+	for _, item := range missing {
+		if err := addMismatch(item, "the item was not found on the index "+indexname+" by its index key"); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// computedMismatch computes the attributes of an item and describes the first one the item does not have
+// with the value computed. It returns an empty string if the item has all of them.
+func computedMismatch(tablename string, item map[string]*dynamodb.AttributeValue, compute func(item map[string]interface{}) (map[string]interface{}, error)) (string, error) {
+	decoded, err := decodeItem(tablename, item, false)
+	if err != nil {
+		return "", err
+	}
+
+	values := map[string]interface{}{}
+	if err := unmarshalMap(decoded, &values); err != nil {
+		return "", err
+	}
+
+	attributes, err := compute(values)
+	if err != nil {
+		return "", err
+	}
+
+	for name, value := range attributes {
+		expected, err := marshalValue(value)
+		if err != nil {
+			return "", err
+		}
+
+		actual, ok := decoded[name]
+		if !ok {
+			return "the item does not have the attribute " + name, nil
+		}
+		if !sameAttribute(actual, expected) {
+			return "the attribute " + name + " of the item differs from the value computed", nil
+		}
+	}
+
+	return "", nil
+}
+
+// sameAttribute tells whether two attributes hold the same value, ignoring the order of the sets and the
+// format of the numbers.
+func sameAttribute(a *dynamodb.AttributeValue, b *dynamodb.AttributeValue) bool {
+	var bufferA, bufferB bytes.Buffer
+	writeCanonical(&bufferA, a)
+	writeCanonical(&bufferB, b)
+	return bytes.Equal(bufferA.Bytes(), bufferB.Bytes())
+}
+
+// sampleItems reads up to 'size' items, starting from a random segment of the table.
+func sampleItems(tablename string, size int) ([]map[string]*dynamodb.AttributeValue, error) {
+	const segments = 16
+
+	svc := newClient()
+	sample := []map[string]*dynamodb.AttributeValue{}
+	first := rand.Intn(segments)
+
+	for i := 0; i < segments && len(sample) < size; i++ {
+		input := &dynamodb.ScanInput{
+			TableName:     aws.String(tablename),
+			Segment:       aws.Int64(int64((first + i) % segments)),
+			TotalSegments: aws.Int64(segments),
+		}
+
+		err := svc.ScanPages(input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+			for _, item := range page.Items {
+				if len(sample) < size {
+					sample = append(sample, item)
+				}
+			}
+			return len(sample) < size
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sample, nil
+}
+
+// isOnIndex queries the index by the index key of the item and tells whether the item is among the results.
+func isOnIndex(tablename string, indexname string, item map[string]*dynamodb.AttributeValue, pkName string, skName string, indexPKName string, indexSKName string) (bool, error) {
+	keyAttributes, _ := extractKeyAttributes(item, pkName, skName)
+	expected := itemCacheKey(tablename, keyAttributes)
+
+	expression := "#ipk = :ipk"
+	names := map[string]*string{"#ipk": aws.String(indexPKName)}
+	values := map[string]*dynamodb.AttributeValue{":ipk": item[indexPKName]}
+
+	if len(indexSKName) > 0 {
+		expression += " AND #isk = :isk"
+		names["#isk"] = aws.String(indexSKName)
+		values[":isk"] = item[indexSKName]
+	}
+
+	found := false
+
+	err := newClient().QueryPages(&dynamodb.QueryInput{
+		TableName:                 aws.String(tablename),
+		IndexName:                 aws.String(indexname),
+		KeyConditionExpression:    aws.String(expression),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, indexed := range page.Items {
+			indexedKey, _ := extractKeyAttributes(indexed, pkName, skName)
+			if itemCacheKey(tablename, indexedKey) == expected {
+				found = true
+			}
+		}
+		return !found
+	})
+
+	return found, err
+}
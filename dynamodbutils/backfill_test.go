@@ -0,0 +1,51 @@
+package dynamodbutils
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestBackfillIndex(t *testing.T) {
+	table := "backfill"
+	createTable(table)
+	defer dynamodbClient.DeleteTable(&dynamodb.DeleteTableInput{TableName: &table})
+
+	for id := 1; id <= 20; id++ {
+		check(PutItem(table, map[string]interface{}{"State": "MG", "Id": id, "Population": id * 1000}))
+	}
+	// an item that already has the attribute is kept
+	check(PutItem(table, City{State: "MG", Id: 21, Name: "Uberaba"}))
+
+	report, err := BackfillIndex(context.Background(), BackfillJob{
+		TableName: table,
+		IndexName: indexname,
+		Compute: func(item map[string]interface{}) (map[string]interface{}, error) {
+			return map[string]interface{}{"Name": fmt.Sprintf("%v-%v", item["State"], item["Id"])}, nil
+		},
+		Segments:            2,
+		MaxUpdatesPerSecond: 1000,
+	})
+	check(err)
+
+	if report.Scanned != 21 || report.Updated != 20 || report.Skipped != 1 {
+		t.Errorf("unexpected backfill totals %+v", report.BackfillProgress)
+	}
+	// the item that kept its attribute differs from the value computed
+	if report.Check.Sampled != 21 || len(report.Check.Mismatches) != 1 || report.Check.Mismatches[0].Key["Id"] != 21.0 {
+		t.Errorf("unexpected index check %+v", report.Check)
+	}
+
+	city := City{}
+	check(FindOneFromIndex(table, indexname, Key{PKName: "Name", PKValue: "MG-7"}, &city))
+	if city.Id != 7 {
+		t.Errorf("the city 7 should have been found on the index but got %+v", city)
+	}
+
+	check(GetItem(table, Key{PKName: "State", PKValue: "MG", SKName: "Id", SKValue: 21}, &city))
+	if city.Name != "Uberaba" {
+		t.Errorf("the existing attribute should have been kept but was '%s'", city.Name)
+	}
+}
@@ -0,0 +1,283 @@
+package dynamodbutils
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// backupPollInterval is the interval between the checks made while waiting for a backup or a restore to finish.
+var backupPollInterval = 10 * time.Second
+
+// Backup describes an on-demand backup of a table.
+//   - Arn: identifies the backup on DeleteBackup and RestoreTableFromBackup.
+//   - Status: CREATING, AVAILABLE or DELETED.
+//   - Type: USER for the backups created with CreateBackup, SYSTEM or AWS_BACKUP for the others.
+type Backup struct {
+	Arn       string
+	Name      string
+	TableName string
+	Status    string
+	Type      string
+	CreatedAt time.Time
+	SizeBytes int64
+}
+
+// PointInTimeRecovery describes the point-in-time recovery of a table. When it is enabled the table can be
+// restored to any second between EarliestRestorableTime and LatestRestorableTime.
+type PointInTimeRecovery struct {
+	Enabled                bool
+	EarliestRestorableTime time.Time
+	LatestRestorableTime   time.Time
+}
+
+// CreateBackup creates an on-demand backup of a table and waits until it is available.
+//
+// Example:
+//
+// backup, err := CreateBackup(ctx, "Orders", "Orders-before-migration-42")
+//
+// The errors returned are:
+//   - the error of the context, if it is done before the backup is available. The backup is still created.
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/dynamodb/#DynamoDB.CreateBackup
+func CreateBackup(ctx context.Context, tablename string, backupName string) (Backup, error) {
+	svc := newClient()
+
+	output, err := svc.CreateBackupWithContext(ctx, &dynamodb.CreateBackupInput{
+		TableName:  aws.String(tablename),
+		BackupName: aws.String(backupName),
+	})
+	if err != nil {
+		return Backup{}, err
+	}
+
+	backupArn := aws.StringValue(output.BackupDetails.BackupArn)
+
+	for {
+		described, err := svc.DescribeBackupWithContext(ctx, &dynamodb.DescribeBackupInput{
+			BackupArn: aws.String(backupArn),
+		})
+		if err != nil {
+			return Backup{}, err
+		}
+
+		backup := newBackup(described.BackupDescription.BackupDetails)
+		backup.TableName = tablename
+
+		switch backup.Status {
+		case dynamodb.BackupStatusAvailable:
+			return backup, nil
+		case dynamodb.BackupStatusDeleted:
+			return backup, errors.New("dynamodbutils.CreateBackup: the backup " + backupArn + " was deleted while being created")
+		}
+
+		if err := sleep(ctx, backupPollInterval); err != nil {
+			return backup, err
+		}
+	}
+}
+
+// ListBackups returns the on-demand backups of a table, sorted by CreatedAt, the oldest first. If 'tablename'
+// is empty the backups of all the tables are returned.
+//
+// Example:
+//
+// backups, err := ListBackups(ctx, "Orders")
+func ListBackups(ctx context.Context, tablename string) ([]Backup, error) {
+	svc := newClient()
+
+	input := &dynamodb.ListBackupsInput{}
+	if len(tablename) > 0 {
+		input.TableName = aws.String(tablename)
+	}
+
+	backups := []Backup{}
+
+	for {
+		output, err := svc.ListBackupsWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, summary := range output.BackupSummaries {
+			backups = append(backups, Backup{
+				Arn:       aws.StringValue(summary.BackupArn),
+				Name:      aws.StringValue(summary.BackupName),
+				TableName: aws.StringValue(summary.TableName),
+				Status:    aws.StringValue(summary.BackupStatus),
+				Type:      aws.StringValue(summary.BackupType),
+				CreatedAt: aws.TimeValue(summary.BackupCreationDateTime),
+				SizeBytes: aws.Int64Value(summary.BackupSizeBytes),
+			})
+		}
+
+		if output.LastEvaluatedBackupArn == nil {
+			break
+		}
+		input.ExclusiveStartBackupArn = output.LastEvaluatedBackupArn
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.Before(backups[j].CreatedAt)
+	})
+
+	return backups, nil
+}
+
+// DeleteBackup deletes an on-demand backup.
+//
+// The errors returned are:
+//   - BackupNotFoundException: the backup does not exist.
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/dynamodb/#DynamoDB.DeleteBackup
+func DeleteBackup(ctx context.Context, backupArn string) error {
+	svc := newClient()
+
+	_, err := svc.DeleteBackupWithContext(ctx, &dynamodb.DeleteBackupInput{
+		BackupArn: aws.String(backupArn),
+	})
+
+	return err
+}
+
+// EnablePointInTimeRecovery enables the continuous backups of a table, which allow it to be restored to
+// any second of the last 35 days with RestoreTableToPointInTime.
+func EnablePointInTimeRecovery(ctx context.Context, tablename string) error {
+	svc := newClient()
+
+	_, err := svc.UpdateContinuousBackupsWithContext(ctx, &dynamodb.UpdateContinuousBackupsInput{
+		TableName: aws.String(tablename),
+		PointInTimeRecoverySpecification: &dynamodb.PointInTimeRecoverySpecification{
+			PointInTimeRecoveryEnabled: aws.Bool(true),
+		},
+	})
+
+	return err
+}
+
+// DescribePointInTimeRecovery tells whether the point-in-time recovery of a table is enabled and the
+// period to which it can be restored.
+func DescribePointInTimeRecovery(ctx context.Context, tablename string) (PointInTimeRecovery, error) {
+	svc := newClient()
+
+	output, err := svc.DescribeContinuousBackupsWithContext(ctx, &dynamodb.DescribeContinuousBackupsInput{
+		TableName: aws.String(tablename),
+	})
+	if err != nil {
+		return PointInTimeRecovery{}, err
+	}
+
+	description := output.ContinuousBackupsDescription.PointInTimeRecoveryDescription
+	if description == nil {
+		return PointInTimeRecovery{}, nil
+	}
+
+	return PointInTimeRecovery{
+		Enabled:                aws.StringValue(description.PointInTimeRecoveryStatus) == dynamodb.PointInTimeRecoveryStatusEnabled,
+		EarliestRestorableTime: aws.TimeValue(description.EarliestRestorableDateTime),
+		LatestRestorableTime:   aws.TimeValue(description.LatestRestorableDateTime),
+	}, nil
+}
+
+// RestoreTableFromBackup creates the table 'targetTablename' from a backup and waits until it is active,
+// which may take from minutes to hours depending on the size of the table.
+//
+// The restored table has the indexes and the capacity settings of the backup, but not its auto scaling
+// policies, time to live, tags, streams or point-in-time recovery settings, which must be set again.
+//
+// The errors returned are:
+//   - TableAlreadyExistsException: the target table already exists.
+//   - the error of the context, if it is done before the table is active. The restore goes on.
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/dynamodb/#DynamoDB.RestoreTableFromBackup
+func RestoreTableFromBackup(ctx context.Context, backupArn string, targetTablename string) error {
+	svc := newClient()
+
+	_, err := svc.RestoreTableFromBackupWithContext(ctx, &dynamodb.RestoreTableFromBackupInput{
+		BackupArn:       aws.String(backupArn),
+		TargetTableName: aws.String(targetTablename),
+	})
+	if err != nil {
+		return err
+	}
+
+	return waitForTableActive(ctx, svc, targetTablename)
+}
+
+// RestoreTableToPointInTime creates the table 'targetTablename' with the contents 'sourceTablename' had at
+// the given time and waits until it is active. If 'restoreTime' is the zero time the latest restorable time
+// is used. The point-in-time recovery of the source table must be enabled.
+//
+// As with RestoreTableFromBackup, the settings not kept by the restore must be set again on the new table.
+//
+// The errors returned are:
+//   - PointInTimeRecoveryUnavailableException: the point-in-time recovery of the source table is not enabled.
+//   - InvalidRestoreTimeException: the time is out of the restorable period.
+//   - the error of the context, if it is done before the table is active. The restore goes on.
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/dynamodb/#DynamoDB.RestoreTableToPointInTime
+func RestoreTableToPointInTime(ctx context.Context, sourceTablename string, targetTablename string, restoreTime time.Time) error {
+	svc := newClient()
+
+	input := &dynamodb.RestoreTableToPointInTimeInput{
+		SourceTableName: aws.String(sourceTablename),
+		TargetTableName: aws.String(targetTablename),
+	}
+
+	if restoreTime.IsZero() {
+		input.UseLatestRestorableTime = aws.Bool(true)
+	} else {
+		input.RestoreDateTime = aws.Time(restoreTime)
+	}
+
+	if _, err := svc.RestoreTableToPointInTimeWithContext(ctx, input); err != nil {
+		return err
+	}
+
+	return waitForTableActive(ctx, svc, targetTablename)
+}
+
+// waitForTableActive waits until a table being created is active.
+func waitForTableActive(ctx context.Context, svc *dynamodb.DynamoDB, tablename string) error {
+	for {
+		output, err := svc.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{
+			TableName: aws.String(tablename),
+		})
+		if err != nil {
+			return err
+		}
+
+		if aws.StringValue(output.Table.TableStatus) == dynamodb.TableStatusActive {
+			return nil
+		}
+
+		if err := sleep(ctx, backupPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+func newBackup(details *dynamodb.BackupDetails) Backup {
+	return Backup{
+		Arn:       aws.StringValue(details.BackupArn),
+		Name:      aws.StringValue(details.BackupName),
+		Status:    aws.StringValue(details.BackupStatus),
+		Type:      aws.StringValue(details.BackupType),
+		CreatedAt: aws.TimeValue(details.BackupCreationDateTime),
+		SizeBytes: aws.Int64Value(details.BackupSizeBytes),
+	}
+}
+
+// sleep waits for the given duration or until the context is done, returning the error of the context.
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
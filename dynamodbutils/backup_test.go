@@ -0,0 +1,59 @@
+package dynamodbutils
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCreateListAndDeleteBackup(t *testing.T) {
+	ctx := context.Background()
+
+	first, err := CreateBackup(ctx, tablename, "cities-backup-1")
+	check(err)
+
+	second, err := CreateBackup(ctx, tablename, "cities-backup-2")
+	check(err)
+
+	if first.Status != "AVAILABLE" || first.TableName != tablename {
+		t.Errorf("the backup should be available for %s but was %+v", tablename, first)
+	}
+
+	backups, err := ListBackups(ctx, tablename)
+	check(err)
+
+	found := map[string]bool{}
+	for i, backup := range backups {
+		found[backup.Arn] = true
+		if i > 0 && backup.CreatedAt.Before(backups[i-1].CreatedAt) {
+			t.Errorf("the backups should be sorted by CreatedAt but were %+v", backups)
+		}
+	}
+	if !found[first.Arn] || !found[second.Arn] {
+		t.Errorf("the backups %s and %s should have been listed but got %+v", first.Arn, second.Arn, backups)
+	}
+
+	check(DeleteBackup(ctx, first.Arn))
+	check(DeleteBackup(ctx, second.Arn))
+
+	backups, err = ListBackups(ctx, tablename)
+	check(err)
+
+	for _, backup := range backups {
+		if (backup.Arn == first.Arn || backup.Arn == second.Arn) && backup.Status != "DELETED" {
+			t.Errorf("the backup %s should have been deleted but was %+v", backup.Arn, backup)
+		}
+	}
+}
+
+func TestEnableAndDescribePointInTimeRecovery(t *testing.T) {
+	ctx := context.Background()
+
+	check(EnablePointInTimeRecovery(ctx, tablename))
+
+	recovery, err := DescribePointInTimeRecovery(ctx, tablename)
+	check(err)
+
+	if !recovery.Enabled {
+		t.Errorf("the point-in-time recovery should be enabled but got %+v", recovery)
+	}
+}
@@ -0,0 +1,285 @@
+package dynamodbutils
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// maxBatchGetKeys is the maximum number of keys accepted by a call to the BatchGetItem api.
+const maxBatchGetKeys = 100
+
+// maxBatchAttempts is the number of times a batch call is made before giving up on its unprocessed items.
+const maxBatchAttempts = 8
+
+// BatchGetRequest holds the keys to be read from a table by BatchGetItems and the slice to be filled
+// with the items found.
+//   - TableName: the name of the table.
+//   - Keys: the keys of the items to be read.
+//   - PointerToOutputSlice: pointer to the slice that will be filled with the items found, in the same
+//     order of the keys.
+//   - Options: the projection and consistency of the reads from this table. See ReadOptions.
+type BatchGetRequest struct {
+	TableName            string      // mandatory
+	Keys                 []Key       // mandatory
+	PointerToOutputSlice interface{} // mandatory
+	Options              ReadOptions // optional
+}
+
+// BatchGetItems reads items from many tables at once, filling the output slice of each request with the
+// items found on its table. The keys of all the tables are sent together, in groups of 100, and the keys
+// left unprocessed by dynamodb are read again with exponential backoff, as in BatchGetItem.
+//
+// Example:
+//
+// cities := []City{}
+// states := []State{}
+//
+//	err := BatchGetItems([]BatchGetRequest{
+//	    {TableName: "cities", Keys: cityKeys, PointerToOutputSlice: &cities},
+//	    {TableName: "states", Keys: stateKeys, PointerToOutputSlice: &states},
+//	})
+//
+// The errors returned are the same of BatchGetItem.
+func BatchGetItems(requests []BatchGetRequest) error {
+	batches := make(map[string]*batchGetTable, len(requests))
+	pending := []batchGetKey{}
+
+	for _, request := range requests {
+		if _, ok := batches[request.TableName]; ok {
+			return fmt.Errorf("dynamodbutils.BatchGetItems: the table %s was given more than once", request.TableName)
+		}
+
+		batch, err := newBatchGetTable(request)
+		if err != nil {
+			return err
+		}
+
+		batches[request.TableName] = batch
+		pending = append(pending, batch.missingKeys()...)
+	}
+
+	dynamodbClient := newClient()
+
+	attempt := 0
+
+	for len(pending) > 0 {
+		if attempt == maxBatchAttempts {
+			return errors.New("UnprocessedKeysException")
+		}
+
+		if attempt > 0 {
+			time.Sleep(batchBackoff(attempt))
+		}
+		attempt++
+
+		unprocessed := []batchGetKey{}
+
+		for start := 0; start < len(pending); start += maxBatchGetKeys {
+			end := start + maxBatchGetKeys
+			if end > len(pending) {
+				end = len(pending)
+			}
+
+			input := &dynamodb.BatchGetItemInput{RequestItems: make(map[string]*dynamodb.KeysAndAttributes)}
+
+			for _, key := range pending[start:end] {
+				keysAndAttributes, ok := input.RequestItems[key.tablename]
+				if !ok {
+					keysAndAttributes = batches[key.tablename].keysAndAttributes()
+					input.RequestItems[key.tablename] = keysAndAttributes
+				}
+				keysAndAttributes.Keys = append(keysAndAttributes.Keys, key.attributes)
+			}
+
+			result, err := dynamodbClient.BatchGetItem(input)
+			if err != nil {
+				return err
+			}
+
+			for tablename, items := range result.Responses {
+				batches[tablename].addItems(items)
+			}
+
+			for tablename, keysAndAttributes := range result.UnprocessedKeys {
+				for _, keyAttributes := range keysAndAttributes.Keys {
+					unprocessed = append(unprocessed, batchGetKey{tablename, keyAttributes})
+				}
+			}
+		}
+
+		if len(unprocessed) < len(pending) {
+			// some progress was made: the backoff restarts
+			attempt = 1
+		}
+
+		pending = unprocessed
+	}
+
+	for _, request := range requests {
+		if err := batches[request.TableName].fillOutput(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// batchGetKey is a key to be read from a table.
+type batchGetKey struct {
+	tablename  string
+	attributes map[string]*dynamodb.AttributeValue
+}
+
+// batchGetTable holds the state of the reads from a table made by BatchGetItems.
+type batchGetTable struct {
+	request       BatchGetRequest
+	outputType    reflect.Type
+	keyAttributes []map[string]*dynamodb.AttributeValue
+	missing       map[string]Key
+	generations   map[string]uint64
+	items         map[string]map[string]*dynamodb.AttributeValue
+	projection    *expression.Expression
+}
+
+func newBatchGetTable(request BatchGetRequest) (*batchGetTable, error) {
+	rv := reflect.ValueOf(request.PointerToOutputSlice)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("dynamodbutils.BatchGetItems: pointerToOutputSlice must be a slice pointer")
+	}
+
+	batch := &batchGetTable{
+		request:     request,
+		outputType:  rv.Type(),
+		missing:     make(map[string]Key),
+		generations: make(map[string]uint64),
+		items:       make(map[string]map[string]*dynamodb.AttributeValue),
+	}
+
+	for _, key := range request.Keys {
+		keyAttributes, err := marshalKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		batch.keyAttributes = append(batch.keyAttributes, keyAttributes)
+
+		cacheKey := itemCacheKey(request.TableName, keyAttributes)
+
+		if request.Options.usesCache() {
+			if item, found := getCachedItem(request.TableName, keyAttributes); found {
+				batch.items[cacheKey] = item
+				continue
+			}
+		}
+
+		// the repeated keys are read only once, since dynamodb rejects them
+		batch.missing[cacheKey] = key
+		batch.generations[cacheKey] = currentCacheGeneration(request.TableName, keyAttributes)
+	}
+
+	projectionAttributes := request.Options.projectionAttributes(batch.outputType)
+	if len(projectionAttributes) > 0 && len(request.Keys) > 0 {
+		// the key attributes are needed to match the items returned with the keys requested
+		projectionAttributes = append(projectionAttributes, request.Keys[0].PKName)
+		if len(request.Keys[0].SKName) > 0 {
+			projectionAttributes = append(projectionAttributes, request.Keys[0].SKName)
+		}
+	}
+
+	if projection, ok := buildProjection(projectionAttributes); ok {
+		expr, err := expression.NewBuilder().WithProjection(projection).Build()
+		if err != nil {
+			return nil, err
+		}
+		batch.projection = &expr
+	}
+
+	return batch, nil
+}
+
+// missingKeys returns the keys that were not found on the cache and must be read from the table.
+func (b *batchGetTable) missingKeys() []batchGetKey {
+	keys := []batchGetKey{}
+	seen := make(map[string]bool)
+
+	for _, keyAttributes := range b.keyAttributes {
+		cacheKey := itemCacheKey(b.request.TableName, keyAttributes)
+		if _, ok := b.missing[cacheKey]; ok && !seen[cacheKey] {
+			seen[cacheKey] = true
+			keys = append(keys, batchGetKey{b.request.TableName, keyAttributes})
+		}
+	}
+
+	return keys
+}
+
+// keysAndAttributes returns the settings of the reads from the table, without the keys.
+func (b *batchGetTable) keysAndAttributes() *dynamodb.KeysAndAttributes {
+	keysAndAttributes := &dynamodb.KeysAndAttributes{
+		ConsistentRead: aws.Bool(b.request.Options.ConsistentRead),
+	}
+
+	if b.projection != nil {
+		keysAndAttributes.ProjectionExpression = b.projection.Projection()
+		keysAndAttributes.ExpressionAttributeNames = b.projection.Names()
+	}
+
+	return keysAndAttributes
+}
+
+// addItems stores the items returned by dynamodb.
+func (b *batchGetTable) addItems(items []map[string]*dynamodb.AttributeValue) {
+	key := b.request.Keys[0]
+
+	for _, item := range items {
+		keyAttributes, _ := extractKeyAttributes(item, key.PKName, key.SKName)
+		b.items[itemCacheKey(b.request.TableName, keyAttributes)] = item
+	}
+}
+
+// fillOutput caches the items read and fills the output slice with the items found, in the order of the keys.
+func (b *batchGetTable) fillOutput() error {
+	tablename := b.request.TableName
+
+	if b.projection == nil {
+		for _, keyAttributes := range b.keyAttributes {
+			cacheKey := itemCacheKey(tablename, keyAttributes)
+			if key, ok := b.missing[cacheKey]; ok {
+				// the keys whose items were not returned do not exist and are cached as such
+				cacheItem(tablename, key, keyAttributes, b.items[cacheKey], b.generations[cacheKey])
+			}
+		}
+	}
+
+	deletedAt := b.request.Options.deletedAtAttribute(b.outputType)
+
+	items := []map[string]*dynamodb.AttributeValue{}
+	for _, keyAttributes := range b.keyAttributes {
+		item := b.items[itemCacheKey(tablename, keyAttributes)]
+		if item != nil && !isSoftDeleted(item, deletedAt) {
+			items = append(items, item)
+		}
+	}
+
+	if len(items) == 0 {
+		return nil
+	}
+
+	return unmarshalItems(tablename, items, b.request.PointerToOutputSlice, b.request.Options.projects(b.outputType))
+}
+
+// batchBackoff returns the time to wait before the given attempt of a batch call: it starts at 50ms and
+// doubles on each attempt, up to 5s.
+func batchBackoff(attempt int) time.Duration {
+	backoff := 50 * time.Millisecond << uint(attempt-1)
+	if backoff > 5*time.Second || backoff <= 0 {
+		backoff = 5 * time.Second
+	}
+	return backoff
+}
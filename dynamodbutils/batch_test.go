@@ -0,0 +1,51 @@
+package dynamodbutils
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestBatchGetItems(t *testing.T) {
+	capitals := "capitals"
+	createTable(capitals)
+	defer dynamodbClient.DeleteTable(&dynamodb.DeleteTableInput{TableName: &capitals})
+
+	cityKeys := []Key{}
+	for id := 1; id <= 150; id++ {
+		check(PutItem(tablename, City{State: "BATCH", Id: id, Name: "City"}))
+		cityKeys = append(cityKeys, Key{PKName: "State", PKValue: "BATCH", SKName: "Id", SKValue: id})
+	}
+	// repeated and inexistent keys
+	cityKeys = append(cityKeys, cityKeys[0], Key{PKName: "State", PKValue: "BATCH", SKName: "Id", SKValue: 1000})
+
+	check(PutItem(capitals, City{State: "MG", Id: 1, Name: "Belo Horizonte"}))
+	check(PutItem(capitals, City{State: "SP", Id: 1, Name: "São Paulo"}))
+
+	cities := []City{}
+	capitalCities := []City{}
+
+	err := BatchGetItems([]BatchGetRequest{
+		{TableName: tablename, Keys: cityKeys, PointerToOutputSlice: &cities},
+		{TableName: capitals, Keys: []Key{
+			{PKName: "State", PKValue: "SP", SKName: "Id", SKValue: 1},
+			{PKName: "State", PKValue: "MG", SKName: "Id", SKValue: 1},
+		}, PointerToOutputSlice: &capitalCities, Options: ReadOptions{Attributes: []string{"Name"}}},
+	})
+	check(err)
+
+	if len(cities) != 151 || cities[0].Id != 1 || cities[149].Id != 150 || cities[150].Id != 1 {
+		t.Errorf("151 cities should have been read in the order of the keys but %d were read", len(cities))
+	}
+
+	if len(capitalCities) != 2 || capitalCities[0].Name != "São Paulo" || capitalCities[1].Name != "Belo Horizonte" {
+		t.Errorf("the capitals were not read in the order of the keys: %+v", capitalCities)
+	}
+
+	if err := BatchGetItems([]BatchGetRequest{
+		{TableName: capitals, Keys: cityKeys, PointerToOutputSlice: &cities},
+		{TableName: capitals, Keys: cityKeys, PointerToOutputSlice: &cities},
+	}); err == nil {
+		t.Errorf("BatchGetItems should fail when a table is given twice")
+	}
+}
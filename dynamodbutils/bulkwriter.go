@@ -0,0 +1,378 @@
+package dynamodbutils
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// maxBatchWriteItems is the maximum number of writes accepted by a call to the BatchWriteItem api.
+const maxBatchWriteItems = 25
+
+// BulkWriterOptions holds the settings of a BulkWriter.
+//   - WriteCapacityUnits: the target rate of the writes, in write capacity units per second. Each item
+//     consumes one unit per KB of its size; the deletes are counted as one unit. Must be greater than zero.
+//   - MaxAttempts: how many times a batch is sent while it is throttled before the write fails. Default 10.
+//   - OnProgress: called after every batch written, with the totals since the writer was created.
+type BulkWriterOptions struct {
+	WriteCapacityUnits float64                 // mandatory
+	MaxAttempts        int                     // optional
+	OnProgress         func(BulkWriteProgress) // optional
+}
+
+// BulkWriteProgress reports the progress of a BulkWriter.
+//   - Written: the number of items written (puts and deletes).
+//   - ConsumedCapacity: the write capacity units consumed, as reported by dynamodb.
+//   - Throttled: the number of times a batch was throttled, fully or partially.
+//   - Rate: the current rate of the writer, in write capacity units per second. It is lowered when the
+//     writes are throttled and raised back to the target as they succeed.
+//   - Pending: the number of items buffered and not written yet.
+type BulkWriteProgress struct {
+	Written          int64
+	ConsumedCapacity float64
+	Throttled        int64
+	Rate             float64
+	Pending          int
+}
+
+// BulkWriter loads items into a table with BatchWriteItem, limiting the writes to a target rate of write
+// capacity units so provisioned tables are not throttled. The items are buffered and sent in batches of 25.
+// When the writes are throttled the rate is halved and the batch is sent again after a backoff; the rate
+// then grows back to the target as the writes succeed.
+//
+// The items are marshaled as in PutItem, except that BatchWriteItem cannot keep the createdAt audit attribute
+// of the items replaced, nor remove the attributes of the replaced items that were offloaded to s3.
+//
+// A BulkWriter is not safe for concurrent use.
+//
+// Example:
+//
+// writer, err := NewBulkWriter("Orders", BulkWriterOptions{WriteCapacityUnits: 100})
+//
+//	for _, order := range orders {
+//	    if err := writer.Put(order); err != nil {
+//	        return err
+//	    }
+//	}
+//
+// err := writer.Flush()
+type BulkWriter struct {
+	tablename string
+	opts      BulkWriterOptions
+
+	pkName string
+	skName string
+
+	pending     []bulkWrite
+	pendingKeys map[string]bool
+
+	rate       float64
+	tokens     float64
+	lastRefill time.Time
+
+	progress BulkWriteProgress
+}
+
+// bulkWrite is a put or a delete waiting to be written.
+type bulkWrite struct {
+	request   *dynamodb.WriteRequest
+	units     float64
+	offloaded []s3Location
+}
+
+// NewBulkWriter creates a BulkWriter for the given table.
+// It fails if WriteCapacityUnits is not greater than zero.
+func NewBulkWriter(tablename string, opts BulkWriterOptions) (*BulkWriter, error) {
+	if opts.WriteCapacityUnits <= 0 {
+		return nil, errors.New("dynamodbutils.NewBulkWriter: WriteCapacityUnits must be greater than zero")
+	}
+
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 10
+	}
+
+	return &BulkWriter{
+		tablename:   tablename,
+		opts:        opts,
+		pendingKeys: make(map[string]bool),
+		rate:        opts.WriteCapacityUnits,
+		tokens:      opts.WriteCapacityUnits,
+		lastRefill:  time.Now(),
+	}, nil
+}
+
+// Put adds an item to be written, writing the buffered items when a batch is complete.
+func (w *BulkWriter) Put(item interface{}) error {
+	dynamoItem, offloaded, err := marshalItem(w.tablename, item)
+	if err != nil {
+		return err
+	}
+
+	keyAttributes, err := w.keyAttributes(dynamoItem)
+	if err == nil && itemValidation {
+		err = validateItem("BulkWriter.Put", dynamoItem, w.pkName, w.skName)
+	}
+	if err != nil {
+		deleteOffloadedObjects(offloaded)
+		return err
+	}
+
+	return w.add(keyAttributes, bulkWrite{
+		request:   &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: dynamoItem}},
+		units:     writeCapacityUnits(itemSize(dynamoItem)),
+		offloaded: offloaded,
+	})
+}
+
+// Delete adds the deletion of an item to be written, writing the buffered items when a batch is complete.
+func (w *BulkWriter) Delete(key Key) error {
+	keyAttributes, err := marshalKey(key)
+	if err != nil {
+		return err
+	}
+
+	return w.add(keyAttributes, bulkWrite{
+		request: &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{Key: keyAttributes}},
+		units:   1,
+	})
+}
+
+// Flush writes all the buffered items.
+//
+// The errors returned are:
+//   - UnprocessedItemsException: some of the items were still throttled after MaxAttempts. They are kept
+//     buffered, so Flush can be called again.
+//     Note: use 'err.Error() == "UnprocessedItemsException"' to identify this error.
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/dynamodb/#DynamoDB.BatchWriteItem
+func (w *BulkWriter) Flush() error {
+	for len(w.pending) > 0 {
+		if err := w.writeBatch(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Progress returns the progress of the writer.
+func (w *BulkWriter) Progress() BulkWriteProgress {
+	progress := w.progress
+	progress.Rate = w.rate
+	progress.Pending = len(w.pending)
+	return progress
+}
+
+func (w *BulkWriter) add(keyAttributes map[string]*dynamodb.AttributeValue, write bulkWrite) error {
+	// dynamodb rejects batches writing the same key twice
+	cacheKey := itemCacheKey(w.tablename, keyAttributes)
+	if w.pendingKeys[cacheKey] {
+		if err := w.Flush(); err != nil {
+			deleteOffloadedObjects(write.offloaded)
+			return err
+		}
+	}
+
+	w.pending = append(w.pending, write)
+	w.pendingKeys[cacheKey] = true
+
+	if len(w.pending) >= maxBatchWriteItems {
+		return w.writeBatch()
+	}
+
+	return nil
+}
+
+func (w *BulkWriter) keyAttributes(item map[string]*dynamodb.AttributeValue) (map[string]*dynamodb.AttributeValue, error) {
+	if len(w.pkName) == 0 {
+		pkName, skName, err := tableKeyNames(w.tablename)
+		if err != nil {
+			return nil, err
+		}
+		w.pkName, w.skName = pkName, skName
+	}
+
+	keyAttributes, ok := extractKeyAttributes(item, w.pkName, w.skName)
+	if !ok {
+		return nil, errors.New("dynamodbutils.BulkWriter: the item does not have the key attributes of the table " + w.tablename)
+	}
+
+	return keyAttributes, nil
+}
+
+// writeBatch writes the first batch of the buffered items, retrying the throttled ones.
+func (w *BulkWriter) writeBatch() error {
+	batch := w.pending
+	if len(batch) > maxBatchWriteItems {
+		batch = batch[:maxBatchWriteItems]
+	}
+	rest := w.pending[len(batch):]
+
+	// the SDK does not retry the throttled requests, so the throttling adjusts the rate of the writer
+	svc := newClient(request.WithRetryer(&aws.Config{EnforceShouldRetryCheck: aws.Bool(true)}, bulkWriterRetryer{
+		DefaultRetryer: client.DefaultRetryer{NumMaxRetries: 10, MinRetryDelay: 50 * time.Millisecond},
+	}))
+
+	for attempt := 1; len(batch) > 0; attempt++ {
+		units := 0.0
+		requests := make([]*dynamodb.WriteRequest, 0, len(batch))
+		for _, write := range batch {
+			units += write.units
+			requests = append(requests, write.request)
+		}
+
+		w.take(units)
+
+		output, err := svc.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+			RequestItems:           map[string][]*dynamodb.WriteRequest{w.tablename: requests},
+			ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
+		})
+
+		throttled := isThrottling(err)
+		if err != nil && !throttled {
+			return err
+		}
+
+		unprocessed := []bulkWrite{}
+		if throttled {
+			unprocessed = batch
+		} else {
+			writesByKey := make(map[string]bulkWrite, len(batch))
+			for _, write := range batch {
+				writesByKey[w.writeRequestKey(write.request)] = write
+			}
+			for _, request := range output.UnprocessedItems[w.tablename] {
+				unprocessed = append(unprocessed, writesByKey[w.writeRequestKey(request)])
+			}
+			w.written(batch, unprocessed, output.ConsumedCapacity)
+		}
+
+		if len(unprocessed) == 0 {
+			w.increaseRate()
+			break
+		}
+
+		w.progress.Throttled++
+		w.decreaseRate()
+
+		if attempt == w.opts.MaxAttempts {
+			w.pending = append(unprocessed, rest...)
+			w.resetPendingKeys()
+			return errors.New("UnprocessedItemsException")
+		}
+
+		time.Sleep(batchBackoff(attempt))
+
+		batch = unprocessed
+	}
+
+	w.pending = rest
+	w.resetPendingKeys()
+
+	if w.opts.OnProgress != nil {
+		w.opts.OnProgress(w.Progress())
+	}
+
+	return nil
+}
+
+// written updates the progress and the cache after a batch was written.
+func (w *BulkWriter) written(batch []bulkWrite, unprocessed []bulkWrite, consumed []*dynamodb.ConsumedCapacity) {
+	processed := make(map[*dynamodb.WriteRequest]bool)
+	for _, write := range batch {
+		processed[write.request] = true
+	}
+	for _, write := range unprocessed {
+		delete(processed, write.request)
+	}
+
+	for request := range processed {
+		if request.PutRequest != nil {
+			invalidateCachedItem(w.tablename, request.PutRequest.Item)
+		} else {
+			invalidateCachedKey(w.tablename, request.DeleteRequest.Key)
+		}
+	}
+
+	w.progress.Written += int64(len(processed))
+
+	for _, c := range consumed {
+		w.progress.ConsumedCapacity += aws.Float64Value(c.CapacityUnits)
+	}
+}
+
+// take waits until the token bucket has the given units, then removes them. A batch larger than the bucket
+// leaves it in debt, delaying the next batches.
+func (w *BulkWriter) take(units float64) {
+	now := time.Now()
+	w.tokens = math.Min(w.rate, w.tokens+now.Sub(w.lastRefill).Seconds()*w.rate)
+	w.lastRefill = now
+
+	if w.tokens < units && w.rate > 0 {
+		wait := time.Duration((units - math.Max(w.tokens, 0)) / w.rate * float64(time.Second))
+		time.Sleep(wait)
+		w.tokens += wait.Seconds() * w.rate
+		w.lastRefill = time.Now()
+	}
+
+	w.tokens -= units
+}
+
+// decreaseRate halves the rate after a throttling, down to 5% of the target.
+func (w *BulkWriter) decreaseRate() {
+	w.rate = math.Max(w.rate/2, w.opts.WriteCapacityUnits/20)
+}
+
+// increaseRate raises the rate by 5% of the target after a successful batch, up to the target.
+func (w *BulkWriter) increaseRate() {
+	w.rate = math.Min(w.rate+w.opts.WriteCapacityUnits/20, w.opts.WriteCapacityUnits)
+}
+
+func (w *BulkWriter) resetPendingKeys() {
+	w.pendingKeys = make(map[string]bool, len(w.pending))
+	for _, write := range w.pending {
+		w.pendingKeys[w.writeRequestKey(write.request)] = true
+	}
+}
+
+// writeRequestKey returns the cache key of the item written by a request, used to match the requests
+// returned as unprocessed by dynamodb, which are copies of the ones sent.
+func (w *BulkWriter) writeRequestKey(request *dynamodb.WriteRequest) string {
+	if request.PutRequest != nil {
+		keyAttributes, _ := extractKeyAttributes(request.PutRequest.Item, w.pkName, w.skName)
+		return itemCacheKey(w.tablename, keyAttributes)
+	}
+	return itemCacheKey(w.tablename, request.DeleteRequest.Key)
+}
+
+// bulkWriterRetryer retries the requests as the dynamodb client does by default, except the throttled ones,
+// which the BulkWriter retries itself.
+type bulkWriterRetryer struct {
+	client.DefaultRetryer
+}
+
+func (r bulkWriterRetryer) ShouldRetry(req *request.Request) bool {
+	if isThrottling(req.Error) {
+		return false
+	}
+	return r.DefaultRetryer.ShouldRetry(req)
+}
+
+// isThrottling tells whether the error is caused by the capacity of the table being exceeded.
+func isThrottling(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+
+	switch awsErr.Code() {
+	case dynamodb.ErrCodeProvisionedThroughputExceededException, dynamodb.ErrCodeRequestLimitExceeded, "ThrottlingException":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,41 @@
+package dynamodbutils
+
+import (
+	"testing"
+)
+
+func TestBulkWriter(t *testing.T) {
+	progressCalls := 0
+
+	writer, err := NewBulkWriter(tablename, BulkWriterOptions{
+		WriteCapacityUnits: 1000,
+		OnProgress:         func(progress BulkWriteProgress) { progressCalls++ },
+	})
+	check(err)
+
+	for id := 1; id <= 60; id++ {
+		check(writer.Put(City{State: "BULK", Id: id, Name: "Bulk"}))
+	}
+	// the same key again forces the pending items to be written first
+	check(writer.Put(City{State: "BULK", Id: 60, Name: "Replaced"}))
+	check(writer.Delete(Key{PKName: "State", PKValue: "BULK", SKName: "Id", SKValue: 1}))
+	check(writer.Flush())
+
+	progress := writer.Progress()
+	if progress.Written != 62 || progress.Pending != 0 || progressCalls < 3 {
+		t.Errorf("unexpected progress %+v after %d calls", progress, progressCalls)
+	}
+
+	cities := []City{}
+	check(Query(tablename, KeyCondition{PKName: "State", PKValue: "BULK"}, &cities))
+
+	if len(cities) != 59 || cities[0].Id != 2 || cities[58].Name != "Replaced" {
+		t.Errorf("59 cities should have been written but %d were", len(cities))
+	}
+}
+
+func TestNewBulkWriterRequiresTheRate(t *testing.T) {
+	if _, err := NewBulkWriter(tablename, BulkWriterOptions{}); err == nil {
+		t.Error("a writer without WriteCapacityUnits should have been rejected")
+	}
+}
@@ -0,0 +1,273 @@
+package dynamodbutils
+
+import (
+	"container/list"
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Cache is a read-through cache consulted by GetItem and BatchGetItem before going to dynamodb.
+// The items are stored in their raw dynamodb format and must not be modified by the implementation.
+//
+// A nil item is stored to record that an item does not exist on the table (negative caching):
+// Get must return (nil, true) for it, so GetItem can answer ItemNotFoundException without
+// querying the table.
+//
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	Get(key string) (item map[string]*dynamodb.AttributeValue, found bool)
+	Set(key string, item map[string]*dynamodb.AttributeValue)
+	Delete(key string)
+}
+
+var itemCache Cache
+
+// cachedKeyNames holds, for each table, the key schemas (partition and sort key names) of the items
+// stored in the cache. PutItem uses it to find the cache entries it must invalidate when the key schema
+// of the table cannot be read.
+var cachedKeyNames = make(map[string]map[[2]string]bool)
+var cachedKeyNamesMutex sync.RWMutex
+
+// cacheGenerations are the generations of the cache keys, bumped by every invalidation. A read takes the
+// generation of its key before going to dynamodb and only fills the cache if it did not change meanwhile,
+// so a read that overlaps a write never stores the item as it was before the write. The keys are spread
+// over a fixed number of counters: keys sharing a counter only lose some fills.
+var cacheGenerations [1024]uint64
+
+// SetCache enables the read-through cache on GetItem and BatchGetItem. Items written by PutItem,
+// UpdateItem and DeleteItem are removed from the cache, but writes made by other processes are only
+// seen once the cached entries expire.
+//
+// Use SetCache(NewLRUCache(capacity, ttl)) for the default in-process cache, or SetCache(nil) to disable caching.
+// SetCache is meant to be called once, during the initialization of the application.
+func SetCache(cache Cache) {
+	cachedKeyNamesMutex.Lock()
+	defer cachedKeyNamesMutex.Unlock()
+
+	itemCache = cache
+	cachedKeyNames = make(map[string]map[[2]string]bool)
+}
+
+// itemCacheKey builds the cache key of an item from its table and its key attributes. It is also used to
+// match the items returned by BatchGetItem with the keys requested.
+func itemCacheKey(tablename string, keyAttributes map[string]*dynamodb.AttributeValue) string {
+	// the numbers are normalized, since dynamodb returns "1.5" for a key given as "1.50"
+	normalized := make(map[string]*dynamodb.AttributeValue, len(keyAttributes))
+	for name, attribute := range keyAttributes {
+		if attribute != nil && attribute.N != nil {
+			attribute = &dynamodb.AttributeValue{N: aws.String(canonicalNumber(*attribute.N))}
+		}
+		normalized[name] = attribute
+	}
+
+	// json.Marshal sorts the map keys, so the same key always produces the same string
+	keyJson, _ := json.Marshal(normalized)
+	return tablename + "|" + string(keyJson)
+}
+
+// cacheGeneration returns the counter of the generation of a cache key.
+func cacheGeneration(cacheKey string) *uint64 {
+	h := fnv.New32a()
+	h.Write([]byte(cacheKey))
+	return &cacheGenerations[h.Sum32()%uint32(len(cacheGenerations))]
+}
+
+// currentCacheGeneration returns the generation of the item identified by the given key attributes, to be
+// taken before reading it from dynamodb and passed to cacheItem.
+func currentCacheGeneration(tablename string, keyAttributes map[string]*dynamodb.AttributeValue) uint64 {
+	return atomic.LoadUint64(cacheGeneration(itemCacheKey(tablename, keyAttributes)))
+}
+
+// getCachedItem looks up an item on the cache. It always returns found=false if the cache is disabled.
+func getCachedItem(tablename string, keyAttributes map[string]*dynamodb.AttributeValue) (item map[string]*dynamodb.AttributeValue, found bool) {
+	if itemCache == nil {
+		return nil, false
+	}
+	return itemCache.Get(itemCacheKey(tablename, keyAttributes))
+}
+
+// cacheItem stores an item (or nil, if it was not found) on the cache and records the key schema of the table.
+// The item is not stored if it was invalidated after 'generation' was taken.
+func cacheItem(tablename string, key Key, keyAttributes map[string]*dynamodb.AttributeValue, item map[string]*dynamodb.AttributeValue, generation uint64) {
+	if itemCache == nil {
+		return
+	}
+
+	keyNames := [2]string{key.PKName, key.SKName}
+
+	cachedKeyNamesMutex.RLock()
+	known := cachedKeyNames[tablename][keyNames]
+	cachedKeyNamesMutex.RUnlock()
+
+	if !known {
+		cachedKeyNamesMutex.Lock()
+		if cachedKeyNames[tablename] == nil {
+			cachedKeyNames[tablename] = make(map[[2]string]bool)
+		}
+		cachedKeyNames[tablename][keyNames] = true
+		cachedKeyNamesMutex.Unlock()
+	}
+
+	cacheKey := itemCacheKey(tablename, keyAttributes)
+	itemCache.Set(cacheKey, item)
+
+	// a write invalidated the key while the item was read or stored: the item may be stale
+	if atomic.LoadUint64(cacheGeneration(cacheKey)) != generation {
+		itemCache.Delete(cacheKey)
+	}
+}
+
+// invalidateCachedKey removes from the cache the item identified by the given key attributes.
+func invalidateCachedKey(tablename string, keyAttributes map[string]*dynamodb.AttributeValue) {
+	if itemCache == nil {
+		return
+	}
+
+	cacheKey := itemCacheKey(tablename, keyAttributes)
+	atomic.AddUint64(cacheGeneration(cacheKey), 1)
+	itemCache.Delete(cacheKey)
+}
+
+// invalidateCachedItem removes from the cache the given item, using the key schema of the table to
+// extract its key attributes, or the key schemas already seen for the table if it cannot be described.
+func invalidateCachedItem(tablename string, item map[string]*dynamodb.AttributeValue) {
+	if itemCache == nil {
+		return
+	}
+
+	if pkName, skName, err := tableKeyNames(tablename); err == nil {
+		if keyAttributes, ok := extractKeyAttributes(item, pkName, skName); ok {
+			invalidateCachedKey(tablename, keyAttributes)
+		}
+		return
+	}
+
+	cachedKeyNamesMutex.RLock()
+	defer cachedKeyNamesMutex.RUnlock()
+
+	for keyNames := range cachedKeyNames[tablename] {
+		keyAttributes, ok := extractKeyAttributes(item, keyNames[0], keyNames[1])
+		if ok {
+			invalidateCachedKey(tablename, keyAttributes)
+		}
+	}
+}
+
+// extractKeyAttributes returns the key attributes of an item. The sort key name may be empty.
+func extractKeyAttributes(item map[string]*dynamodb.AttributeValue, pkName string, skName string) (keyAttributes map[string]*dynamodb.AttributeValue, ok bool) {
+	keyAttributes = make(map[string]*dynamodb.AttributeValue)
+
+	if keyAttributes[pkName], ok = item[pkName]; !ok {
+		return nil, false
+	}
+
+	if len(skName) > 0 {
+		if keyAttributes[skName], ok = item[skName]; !ok {
+			return nil, false
+		}
+	}
+
+	return keyAttributes, true
+}
+
+// LRUCache is an in-process Cache that keeps up to 'capacity' items, evicting the least recently
+// used ones, each item living at most 'ttl' on the cache.
+type LRUCache struct {
+	capacity int
+	ttl      time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // front is the most recently used entry
+}
+
+type lruCacheEntry struct {
+	key       string
+	item      map[string]*dynamodb.AttributeValue
+	expiresAt time.Time
+}
+
+// NewLRUCache creates an LRUCache holding up to 'capacity' items for at most 'ttl' each.
+// A ttl of zero means the items never expire and are only evicted when the cache is full.
+func NewLRUCache(capacity int, ttl time.Duration) *LRUCache {
+	return &LRUCache{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get implements Cache.
+func (c *LRUCache) Get(key string) (item map[string]*dynamodb.AttributeValue, found bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+
+	entry := element.Value.(*lruCacheEntry)
+	if c.ttl > 0 && time.Now().After(entry.expiresAt) {
+		c.removeElement(element)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+
+	return entry.item, true
+}
+
+// Set implements Cache.
+func (c *LRUCache) Set(key string, item map[string]*dynamodb.AttributeValue) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.capacity <= 0 {
+		return
+	}
+
+	entry := &lruCacheEntry{key: key, item: item, expiresAt: time.Now().Add(c.ttl)}
+
+	if element, found := c.entries[key]; found {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// Delete implements Cache.
+func (c *LRUCache) Delete(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, found := c.entries[key]; found {
+		c.removeElement(element)
+	}
+}
+
+// Len returns the number of items on the cache, including the expired ones not evicted yet.
+func (c *LRUCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *LRUCache) removeElement(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*lruCacheEntry).key)
+}
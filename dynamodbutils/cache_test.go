@@ -0,0 +1,141 @@
+package dynamodbutils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestLRUCache(t *testing.T) {
+	cache := NewLRUCache(2, time.Hour)
+
+	item := map[string]*dynamodb.AttributeValue{"Name": {S: aws.String("Wayne")}}
+
+	cache.Set("a", item)
+	cache.Set("b", nil)
+	cache.Get("a") // "b" is now the least recently used entry
+	cache.Set("c", item)
+
+	if _, found := cache.Get("b"); found {
+		t.Error("'b' should have been evicted")
+	}
+	if cached, found := cache.Get("a"); !found || *cached["Name"].S != "Wayne" {
+		t.Error("'a' should be on the cache")
+	}
+	if cache.Len() != 2 {
+		t.Errorf("cache should have 2 items but has %d", cache.Len())
+	}
+
+	cache.Delete("a")
+	if _, found := cache.Get("a"); found {
+		t.Error("'a' should have been deleted")
+	}
+
+	expiringCache := NewLRUCache(2, time.Millisecond)
+	expiringCache.Set("a", item)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, found := expiringCache.Get("a"); found {
+		t.Error("'a' should have expired")
+	}
+}
+
+func TestGetItemWithCache(t *testing.T) {
+	SetCache(NewLRUCache(100, time.Minute))
+	defer SetCache(nil)
+
+	city := City{State: "CACHE", Id: 1, Name: "Cached Town"}
+	key := Key{PKName: "State", PKValue: "CACHE", SKName: "Id", SKValue: 1}
+
+	check(PutItem(tablename, city))
+
+	found := City{}
+	check(GetItem(tablename, key, &found))
+
+	// changes the item behind the cache's back, the cached version must still be returned
+	_, err := dynamodbClient.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: &tablename,
+		Key: map[string]*dynamodb.AttributeValue{
+			"State": {S: aws.String("CACHE")},
+			"Id":    {N: aws.String("1")},
+		},
+	})
+	check(err)
+
+	found = City{}
+	check(GetItem(tablename, key, &found))
+	if found.Name != "Cached Town" {
+		t.Errorf("the cached item should have been returned but got %+v", found)
+	}
+
+	// writes through dynamodbutils invalidate the cache
+	city.Name = "Renamed Town"
+	check(PutItem(tablename, city))
+
+	found = City{}
+	check(GetItem(tablename, key, &found))
+	if found.Name != "Renamed Town" {
+		t.Errorf("the cache should have been invalidated by PutItem but got %+v", found)
+	}
+
+	check(DeleteItem(tablename, key))
+
+	err = GetItem(tablename, key, &found)
+	if err == nil || err.Error() != "ItemNotFoundException" {
+		t.Errorf("err should be 'ItemNotFoundException' but was '%v'", err)
+	}
+
+	// the missing item is cached too
+	check(PutItemWithConditional(tablename, city, "attribute_not_exists(Id)", nil))
+	SetCache(NewLRUCache(100, time.Minute))
+
+	cities := []City{}
+	keys := []Key{key, {PKName: "State", PKValue: "CACHE", SKName: "Id", SKValue: 2}}
+	check(BatchGetItem(tablename, keys, &cities))
+	if len(cities) != 1 {
+		t.Errorf("cities should have length 1 but has %d", len(cities))
+	}
+
+	err = GetItem(tablename, keys[1], &found)
+	if err == nil || err.Error() != "ItemNotFoundException" {
+		t.Errorf("err should be 'ItemNotFoundException' but was '%v'", err)
+	}
+}
+
+func TestCacheItemAfterInvalidation(t *testing.T) {
+	SetCache(NewLRUCache(100, time.Minute))
+	defer SetCache(nil)
+
+	key := Key{PKName: "State", PKValue: "GENERATION", SKName: "Id", SKValue: 1}
+	keyAttributes, err := marshalKey(key)
+	check(err)
+
+	item := map[string]*dynamodb.AttributeValue{"Name": {S: aws.String("Stale Town")}}
+
+	// a write invalidates the key while the item is being read: the item read must not be cached
+	generation := currentCacheGeneration(tablename, keyAttributes)
+	invalidateCachedKey(tablename, keyAttributes)
+	cacheItem(tablename, key, keyAttributes, item, generation)
+
+	if _, found := getCachedItem(tablename, keyAttributes); found {
+		t.Error("the item read before the invalidation should not be cached")
+	}
+
+	generation = currentCacheGeneration(tablename, keyAttributes)
+	cacheItem(tablename, key, keyAttributes, item, generation)
+
+	if _, found := getCachedItem(tablename, keyAttributes); !found {
+		t.Error("the item should be cached")
+	}
+}
+
+func TestItemCacheKeyNormalizesNumbers(t *testing.T) {
+	requested := map[string]*dynamodb.AttributeValue{"State": {S: aws.String("MG")}, "Id": {N: aws.String("1.50")}}
+	returned := map[string]*dynamodb.AttributeValue{"State": {S: aws.String("MG")}, "Id": {N: aws.String("1.5")}}
+
+	if itemCacheKey(tablename, requested) != itemCacheKey(tablename, returned) {
+		t.Errorf("the keys should match but were '%s' and '%s'", itemCacheKey(tablename, requested), itemCacheKey(tablename, returned))
+	}
+}
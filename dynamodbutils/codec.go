@@ -0,0 +1,104 @@
+package dynamodbutils
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// marshalItem converts an item (a struct or a map) into the dynamodb format, applying the
+// transformations configured on the package: marshaling options, audit attributes, encryption and offloading of large
+// attributes to s3.
+// It also returns the s3 objects created for the item, so they can be removed if the write fails.
+func marshalItem(tablename string, item interface{}) (dynamoItem map[string]*dynamodb.AttributeValue, offloaded []s3Location, err error) {
+	dynamoItem, err = marshalMap(item)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = applyAuditFields(item, dynamoItem, time.Now()); err != nil {
+		return nil, nil, err
+	}
+
+	if err = checkS3Pointers(dynamoItem); err != nil {
+		return nil, nil, err
+	}
+
+	// the attributes are encrypted before being offloaded, so the objects on s3 are encrypted too
+	dynamoItem, err = encryptAttributes(tablename, reflect.TypeOf(item), dynamoItem)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return offloadAttributes(offloadedAttributeNames(reflect.TypeOf(item)), dynamoItem)
+}
+
+// offloadedAttributeNames returns the names of the attributes of a type tagged to be offloaded to s3.
+func offloadedAttributeNames(itemType reflect.Type) []string {
+	if itemType == nil {
+		return []string{}
+	}
+	return taggedAttributeNames(itemType, "s3")
+}
+
+// unmarshalItem fills the object pointed by 'pointerToOutputObject' with an item read from a table,
+// undoing the transformations made by marshalItem. 'projected' tells whether the item was read with
+// a projection, so some of its attributes may be missing.
+func unmarshalItem(tablename string, item map[string]*dynamodb.AttributeValue, pointerToOutputObject interface{}, projected bool) error {
+	item, err := decodeItem(tablename, item, projected)
+	if err != nil {
+		return err
+	}
+
+	return unmarshalMap(item, pointerToOutputObject)
+}
+
+// unmarshalItems works like unmarshalItem for a list of items and a pointer to a slice.
+func unmarshalItems(tablename string, items []map[string]*dynamodb.AttributeValue, pointerToOutputSlice interface{}, projected bool) error {
+	decodedItems := make([]map[string]*dynamodb.AttributeValue, 0, len(items))
+
+	for _, item := range items {
+		decodedItem, err := decodeItem(tablename, item, projected)
+		if err != nil {
+			return err
+		}
+		decodedItems = append(decodedItems, decodedItem)
+	}
+
+	return unmarshalListOfMaps(decodedItems, pointerToOutputSlice)
+}
+
+// decodeItem undoes the transformations made by marshalItem on an item read from a table.
+// The given item is not modified, since it may be shared with the cache.
+func decodeItem(tablename string, item map[string]*dynamodb.AttributeValue, projected bool) (map[string]*dynamodb.AttributeValue, error) {
+	item, err := rehydrateAttributes(item)
+	if err != nil {
+		return nil, err
+	}
+
+	return decryptAttributes(tablename, item, projected)
+}
+
+// rawAttribute allows passing an attribute already in the dynamodb format to the expression builder.
+type rawAttribute struct {
+	attribute *dynamodb.AttributeValue
+}
+
+func (r rawAttribute) MarshalDynamoDBAttributeValue(av *dynamodb.AttributeValue) error {
+	*av = *r.attribute
+	return nil
+}
+
+// marshaledValue marshals a value with the options set with SetMarshalingOptions, to be passed to the expression builder.
+func marshaledValue(value interface{}) (rawAttribute, error) {
+	attribute, err := marshalValue(value)
+	if err != nil {
+		return rawAttribute{}, err
+	}
+	if attribute == nil {
+		attribute = &dynamodb.AttributeValue{NULL: aws.Bool(true)}
+	}
+	return rawAttribute{attribute}, nil
+}
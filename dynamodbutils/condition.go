@@ -0,0 +1,405 @@
+package dynamodbutils
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Condition is a condition on the attributes of an item, used by PutItemIf, UpdateItemIf and DeleteItemIf
+// to make a write conditional, and by Query (KeyCondition.Filter) and Scan to filter the items read.
+//
+// Conditions are created with the functions Eq, Ne, Lt, Le, Gt, Ge, Between, In, BeginsWith, Contains,
+// AttributeExists, AttributeNotExists and Size, and combined with And, Or and Not. The attribute names
+// and values are replaced by placeholders, so any name can be used, including the dynamodb reserved words.
+// Nested attributes can be given as paths, e.g. "address.city" or "phones[0]".
+//
+// The zero value is an empty condition, which matches every item.
+//
+// Example:
+//
+// condition := And(Eq("Status", "ACTIVE"), Or(Lt("Version", 3), AttributeNotExists("Version")))
+//
+// err := PutItemIf(tablename, item, condition)
+type Condition struct {
+	render func(e *conditionEncoder) (string, error)
+}
+
+// IsEmpty tells whether the condition is empty.
+func (c Condition) IsEmpty() bool {
+	return c.render == nil
+}
+
+// Eq is true when the attribute is equal to the value.
+func Eq(name string, value interface{}) Condition {
+	return comparison(name, "=", value)
+}
+
+// Ne is true when the attribute is not equal to the value. It is true when the attribute does not exist too.
+func Ne(name string, value interface{}) Condition {
+	return comparison(name, "<>", value)
+}
+
+// Lt is true when the attribute is less than the value.
+func Lt(name string, value interface{}) Condition {
+	return comparison(name, "<", value)
+}
+
+// Le is true when the attribute is less than or equal to the value.
+func Le(name string, value interface{}) Condition {
+	return comparison(name, "<=", value)
+}
+
+// Gt is true when the attribute is greater than the value.
+func Gt(name string, value interface{}) Condition {
+	return comparison(name, ">", value)
+}
+
+// Ge is true when the attribute is greater than or equal to the value.
+func Ge(name string, value interface{}) Condition {
+	return comparison(name, ">=", value)
+}
+
+// Between is true when the attribute is greater than or equal to 'low' and less than or equal to 'high'.
+func Between(name string, low interface{}, high interface{}) Condition {
+	return between(func(e *conditionEncoder) (string, error) { return e.name(name) }, low, high)
+}
+
+// In is true when the attribute is equal to one of the values. At least one value must be given.
+func In(name string, values ...interface{}) Condition {
+	return Condition{func(e *conditionEncoder) (string, error) {
+		if len(values) == 0 {
+			return "", errors.New("dynamodbutils.In: at least one value must be given for the attribute " + name)
+		}
+
+		operand, err := e.name(name)
+		if err != nil {
+			return "", err
+		}
+
+		placeholders := make([]string, 0, len(values))
+		for _, value := range values {
+			placeholder, err := e.value(value)
+			if err != nil {
+				return "", err
+			}
+			placeholders = append(placeholders, placeholder)
+		}
+
+		return operand + " IN (" + strings.Join(placeholders, ", ") + ")", nil
+	}}
+}
+
+// BeginsWith is true when the attribute is a string starting with the prefix.
+func BeginsWith(name string, prefix string) Condition {
+	return function("begins_with", name, prefix)
+}
+
+// Contains is true when the attribute is a string containing the value as a substring, or a set or a list
+// containing the value as an element.
+func Contains(name string, value interface{}) Condition {
+	return function("contains", name, value)
+}
+
+// AttributeExists is true when the item has the attribute.
+func AttributeExists(name string) Condition {
+	return Condition{func(e *conditionEncoder) (string, error) {
+		operand, err := e.name(name)
+		if err != nil {
+			return "", err
+		}
+		return "attribute_exists (" + operand + ")", nil
+	}}
+}
+
+// AttributeNotExists is true when the item does not have the attribute. Used with the name of the partition
+// key it makes a write fail if the item already exists.
+func AttributeNotExists(name string) Condition {
+	return Condition{func(e *conditionEncoder) (string, error) {
+		operand, err := e.name(name)
+		if err != nil {
+			return "", err
+		}
+		return "attribute_not_exists (" + operand + ")", nil
+	}}
+}
+
+// And is true when all the conditions are true. Empty conditions are ignored.
+func And(conditions ...Condition) Condition {
+	return logical("AND", conditions)
+}
+
+// Or is true when at least one of the conditions is true. Empty conditions are ignored.
+func Or(conditions ...Condition) Condition {
+	return logical("OR", conditions)
+}
+
+// Not is true when the condition is false.
+func Not(condition Condition) Condition {
+	if condition.IsEmpty() {
+		return condition
+	}
+	return Condition{func(e *conditionEncoder) (string, error) {
+		expression, err := condition.render(e)
+		if err != nil {
+			return "", err
+		}
+		return "NOT (" + expression + ")", nil
+	}}
+}
+
+// SizeOperand is the size of an attribute: the length of a string or binary, or the number of elements
+// of a set, a list or a map. It is created with Size and compared with its methods.
+//
+// Example:
+//
+// filter := Size("Tags").Gt(3)
+type SizeOperand struct {
+	name string
+}
+
+// Size returns the size of the attribute, to be compared with the methods of SizeOperand.
+func Size(name string) SizeOperand {
+	return SizeOperand{name}
+}
+
+// Eq is true when the size of the attribute is equal to the value.
+func (s SizeOperand) Eq(value int) Condition { return s.comparison("=", value) }
+
+// Ne is true when the size of the attribute is not equal to the value.
+func (s SizeOperand) Ne(value int) Condition { return s.comparison("<>", value) }
+
+// Lt is true when the size of the attribute is less than the value.
+func (s SizeOperand) Lt(value int) Condition { return s.comparison("<", value) }
+
+// Le is true when the size of the attribute is less than or equal to the value.
+func (s SizeOperand) Le(value int) Condition { return s.comparison("<=", value) }
+
+// Gt is true when the size of the attribute is greater than the value.
+func (s SizeOperand) Gt(value int) Condition { return s.comparison(">", value) }
+
+// Ge is true when the size of the attribute is greater than or equal to the value.
+func (s SizeOperand) Ge(value int) Condition { return s.comparison(">=", value) }
+
+// Between is true when the size of the attribute is between 'low' and 'high', inclusive.
+func (s SizeOperand) Between(low int, high int) Condition {
+	return between(s.operand, low, high)
+}
+
+func (s SizeOperand) operand(e *conditionEncoder) (string, error) {
+	operand, err := e.name(s.name)
+	if err != nil {
+		return "", err
+	}
+	return "size (" + operand + ")", nil
+}
+
+func (s SizeOperand) comparison(operator string, value int) Condition {
+	return Condition{func(e *conditionEncoder) (string, error) {
+		operand, err := s.operand(e)
+		if err != nil {
+			return "", err
+		}
+		placeholder, err := e.value(value)
+		if err != nil {
+			return "", err
+		}
+		return operand + " " + operator + " " + placeholder, nil
+	}}
+}
+
+func comparison(name string, operator string, value interface{}) Condition {
+	return Condition{func(e *conditionEncoder) (string, error) {
+		operand, err := e.name(name)
+		if err != nil {
+			return "", err
+		}
+		placeholder, err := e.value(value)
+		if err != nil {
+			return "", err
+		}
+		return operand + " " + operator + " " + placeholder, nil
+	}}
+}
+
+func between(operand func(e *conditionEncoder) (string, error), low interface{}, high interface{}) Condition {
+	return Condition{func(e *conditionEncoder) (string, error) {
+		left, err := operand(e)
+		if err != nil {
+			return "", err
+		}
+		lowPlaceholder, err := e.value(low)
+		if err != nil {
+			return "", err
+		}
+		highPlaceholder, err := e.value(high)
+		if err != nil {
+			return "", err
+		}
+		return left + " BETWEEN " + lowPlaceholder + " AND " + highPlaceholder, nil
+	}}
+}
+
+func function(functionName string, name string, value interface{}) Condition {
+	return Condition{func(e *conditionEncoder) (string, error) {
+		operand, err := e.name(name)
+		if err != nil {
+			return "", err
+		}
+		placeholder, err := e.value(value)
+		if err != nil {
+			return "", err
+		}
+		return functionName + " (" + operand + ", " + placeholder + ")", nil
+	}}
+}
+
+func logical(operator string, conditions []Condition) Condition {
+	nonEmpty := []Condition{}
+	for _, condition := range conditions {
+		if !condition.IsEmpty() {
+			nonEmpty = append(nonEmpty, condition)
+		}
+	}
+
+	switch len(nonEmpty) {
+	case 0:
+		return Condition{}
+	case 1:
+		return nonEmpty[0]
+	}
+
+	return Condition{func(e *conditionEncoder) (string, error) {
+		expressions := make([]string, 0, len(nonEmpty))
+		for _, condition := range nonEmpty {
+			expression, err := condition.render(e)
+			if err != nil {
+				return "", err
+			}
+			expressions = append(expressions, "("+expression+")")
+		}
+		return strings.Join(expressions, " "+operator+" "), nil
+	}}
+}
+
+// conditionEncoder replaces the names and values of a condition by placeholders. The placeholders are
+// prefixed with 'c' ("#c0", ":c0") so they do not clash with the ones generated by the expression package.
+type conditionEncoder struct {
+	names        map[string]*string
+	values       map[string]*dynamodb.AttributeValue
+	placeholders map[string]string
+}
+
+// encodedCondition is a condition ready to be sent to dynamodb.
+type encodedCondition struct {
+	Expression *string
+	Names      map[string]*string
+	Values     map[string]*dynamodb.AttributeValue
+}
+
+// encode builds the expression of the condition and its placeholders. An empty condition gives an
+// empty encodedCondition.
+func (c Condition) encode() (encoded encodedCondition, err error) {
+	if c.IsEmpty() {
+		return encoded, nil
+	}
+
+	e := &conditionEncoder{
+		names:        make(map[string]*string),
+		values:       make(map[string]*dynamodb.AttributeValue),
+		placeholders: make(map[string]string),
+	}
+
+	expression, err := c.render(e)
+	if err != nil {
+		return encoded, err
+	}
+
+	encoded.Expression = aws.String(expression)
+	if len(e.names) > 0 {
+		encoded.Names = e.names
+	}
+	if len(e.values) > 0 {
+		encoded.Values = e.values
+	}
+
+	return encoded, nil
+}
+
+var pathElementRegexp = regexp.MustCompile(`^([^\[\]]+)((?:\[\d+\])*)$`)
+
+// name returns the placeholders of an attribute path, e.g. "#c0.#c1[2]" for "address.phones[2]".
+func (e *conditionEncoder) name(path string) (string, error) {
+	if len(path) == 0 {
+		return "", errors.New("dynamodbutils: the attribute name of a condition must not be empty")
+	}
+
+	elements := strings.Split(path, ".")
+
+	for i, element := range elements {
+		match := pathElementRegexp.FindStringSubmatch(element)
+		if match == nil {
+			return "", fmt.Errorf("dynamodbutils: invalid attribute path '%s' in condition", path)
+		}
+
+		placeholder, ok := e.placeholders[match[1]]
+		if !ok {
+			placeholder = fmt.Sprintf("#c%d", len(e.placeholders))
+			e.placeholders[match[1]] = placeholder
+			e.names[placeholder] = aws.String(match[1])
+		}
+
+		elements[i] = placeholder + match[2]
+	}
+
+	return strings.Join(elements, "."), nil
+}
+
+// value returns the placeholder of a value.
+func (e *conditionEncoder) value(value interface{}) (string, error) {
+	// nil values are compared as NULL, as in the expressions built with the expression package
+	raw, err := marshaledValue(value)
+	if err != nil {
+		return "", err
+	}
+
+	placeholder := fmt.Sprintf(":c%d", len(e.values))
+	e.values[placeholder] = raw.attribute
+
+	return placeholder, nil
+}
+
+// mergeExpression joins a condition with another expression, both of which may be nil, with AND.
+func mergeExpression(expression *string, condition *string) *string {
+	switch {
+	case condition == nil:
+		return expression
+	case expression == nil:
+		return condition
+	default:
+		return aws.String("(" + *expression + ") AND (" + *condition + ")")
+	}
+}
+
+// mergePlaceholders copies the placeholders of a condition to the maps of the request, creating them if needed.
+func mergePlaceholders(names map[string]*string, values map[string]*dynamodb.AttributeValue, condition encodedCondition) (map[string]*string, map[string]*dynamodb.AttributeValue) {
+	if len(condition.Names) > 0 && names == nil {
+		names = make(map[string]*string)
+	}
+	for placeholder, name := range condition.Names {
+		names[placeholder] = name
+	}
+
+	if len(condition.Values) > 0 && values == nil {
+		values = make(map[string]*dynamodb.AttributeValue)
+	}
+	for placeholder, value := range condition.Values {
+		values[placeholder] = value
+	}
+
+	return names, values
+}
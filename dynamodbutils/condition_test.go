@@ -0,0 +1,107 @@
+package dynamodbutils
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestConditionEncode(t *testing.T) {
+	condition := And(
+		Eq("Status", "ACTIVE"),
+		Or(Lt("address.number", 10), AttributeNotExists("address.phones[1]")),
+		Not(In("Size", 1, 2)),
+		Size("Status").Between(1, 10),
+		Condition{},
+	)
+
+	encoded, err := condition.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "(#c0 = :c0) AND ((#c1.#c2 < :c1) OR (attribute_not_exists (#c1.#c3[1]))) AND (NOT (#c4 IN (:c2, :c3))) AND (size (#c0) BETWEEN :c4 AND :c5)"
+	if aws.StringValue(encoded.Expression) != expected {
+		t.Errorf("the expression should be\n'%s'\nbut was\n'%s'", expected, aws.StringValue(encoded.Expression))
+	}
+
+	expectedNames := map[string]string{"#c0": "Status", "#c1": "address", "#c2": "number", "#c3": "phones", "#c4": "Size"}
+	if len(encoded.Names) != len(expectedNames) {
+		t.Errorf("the names should be %v but were %v", expectedNames, aws.StringValueMap(encoded.Names))
+	}
+	for placeholder, name := range expectedNames {
+		if aws.StringValue(encoded.Names[placeholder]) != name {
+			t.Errorf("the name of %s should be '%s' but was '%s'", placeholder, name, aws.StringValue(encoded.Names[placeholder]))
+		}
+	}
+
+	if len(encoded.Values) != 6 || aws.StringValue(encoded.Values[":c0"].S) != "ACTIVE" || aws.StringValue(encoded.Values[":c3"].N) != "2" {
+		t.Errorf("unexpected values %v", encoded.Values)
+	}
+
+	if encoded, _ := (Condition{}).encode(); encoded.Expression != nil || encoded.Names != nil || encoded.Values != nil {
+		t.Errorf("an empty condition should be encoded as empty but was %+v", encoded)
+	}
+
+	if _, err := In("Size").encode(); err == nil {
+		t.Errorf("In without values should fail")
+	}
+
+	if _, err := Eq("a..b", 1).encode(); err == nil {
+		t.Errorf("an invalid path should fail")
+	}
+}
+
+func TestConditionalWritesAndScan(t *testing.T) {
+	key := Key{PKName: "State", PKValue: "CONDITION", SKName: "Id", SKValue: 1}
+
+	check(PutItemIf(tablename, City{State: "CONDITION", Id: 1, Name: "Uberaba", Population: 300}, AttributeNotExists("State")))
+
+	if err := PutItemIf(tablename, City{State: "CONDITION", Id: 1, Name: "Uberaba"}, AttributeNotExists("State")); err == nil {
+		t.Errorf("PutItemIf should fail when the item already exists")
+	}
+
+	if err := UpdateItemIf(tablename, key, map[string]interface{}{"Population": 400}, Gt("Population", 500)); err == nil {
+		t.Errorf("UpdateItemIf should fail when the condition is false")
+	}
+	check(UpdateItemIf(tablename, key, map[string]interface{}{"Population": 400}, Between("Population", 200, 300)))
+
+	check(PutItem(tablename, City{State: "CONDITION", Id: 2, Name: "Uberlândia", Population: 700, Aliases: []string{"Udi"}}))
+
+	cities := []City{}
+	check(Query(tablename, KeyCondition{PKName: "State", PKValue: "CONDITION", Filter: Contains("Aliases", "Udi")}, &cities))
+	if len(cities) != 1 || cities[0].Id != 2 {
+		t.Errorf("the query should have returned only the city 2 but returned %+v", cities)
+	}
+
+	cities = []City{}
+	check(Scan(tablename, And(Eq("State", "CONDITION"), BeginsWith("Name", "Uber")), &cities))
+	if len(cities) != 2 {
+		t.Errorf("the scan should have returned 2 cities but returned %+v", cities)
+	}
+
+	if err := DeleteItemIf(tablename, key, Ne("Population", 400)); err == nil {
+		t.Errorf("DeleteItemIf should fail when the condition is false")
+	}
+	check(DeleteItemIf(tablename, key, Eq("Population", 400)))
+}
+
+func TestConditionEncodesNilAsNull(t *testing.T) {
+	var missing *string
+
+	for _, condition := range []Condition{Eq("Nickname", nil), Ne("Nickname", missing), In("Nickname", "a", nil)} {
+		encoded, err := condition.encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for placeholder, value := range encoded.Values {
+			if value == nil {
+				t.Errorf("the value of %s should not be nil on %s", placeholder, aws.StringValue(encoded.Expression))
+			}
+		}
+		if !aws.BoolValue(encoded.Values[":c0"].NULL) && !aws.BoolValue(encoded.Values[":c1"].NULL) {
+			t.Errorf("the nil value should have been encoded as NULL but the values were %v", encoded.Values)
+		}
+	}
+}
@@ -4,12 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
-
-	"github.com/AmeDigital/aws-utils-go/sessionutils"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
 )
 
@@ -21,6 +19,25 @@ type Key struct {
 	SKValue interface{} // optional
 }
 
+// marshalKey converts the given Key into the map of attributes expected by the dynamodb api.
+func marshalKey(key Key) (keyAttributes map[string]*dynamodb.AttributeValue, err error) {
+	keyAttributes = make(map[string]*dynamodb.AttributeValue)
+
+	keyAttributes[key.PKName], err = marshalValue(key.PKValue)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key.SKName) > 0 {
+		keyAttributes[key.SKName], err = marshalValue(key.SKValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return keyAttributes, nil
+}
+
 // UpdateItem updates the fields of an item identified by its partitionKey and sortKey(optional).
 //
 // Arguments:
@@ -30,33 +47,107 @@ type Key struct {
 // key: the item's partition key and optional sort key
 //
 // fields: a map of field name/value pairs that will be updated
+//
+// If the table's audit attributes were registered with RegisterAuditFields the updatedAt attribute is
+// set to the current time. The items written with encryption (see SetEncryption) are signed, so only their
+// audit attributes can be updated: UpdateItem fails, without changing the item, if any other attribute is
+// set. The attributes registered with RegisterS3OffloadFields are offloaded to s3
+// as PutItem does; when offloading is enabled on a table that was not registered, UpdateItem fails instead
+// of overwriting an offloaded attribute.
 func UpdateItem(tablename string, key Key, fields map[string]interface{}) (err error) {
+	return UpdateItemIf(tablename, key, fields, Condition{})
+}
 
-	svc := dynamodb.New(sessionutils.Session)
+// UpdateItemIf updates the fields of an item, like UpdateItem, only if the item matches the given condition.
+//
+// Example:
+//
+// err := UpdateItemIf(tablename, key, map[string]interface{}{"Status": "CLOSED"}, Eq("Status", "OPEN"))
+//
+// The errors returned are:
+//   - ConditionalCheckFailedException: the item does not exist or does not match the condition.
+//   - an error if the item is signed and an attribute other than its audit attributes is set, or if an
+//     offloaded attribute would be overwritten on a table not registered with RegisterS3OffloadFields.
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/dynamodb/#DynamoDB.UpdateItem
+func UpdateItemIf(tablename string, key Key, fields map[string]interface{}, condition Condition) (err error) {
 
-	keyAttributes := make(map[string]*dynamodb.AttributeValue)
+	svc := newClient()
 
-	keyAttributes[key.PKName], err = dynamodbattribute.Marshal(key.PKValue)
+	keyAttributes, err := marshalKey(key)
 	if err != nil {
 		return err
 	}
 
+	pkCondition := expression.Key(key.PKName).Equal(expression.Value(rawAttribute{keyAttributes[key.PKName]}))
 	if len(key.SKName) > 0 {
-		keyAttributes[key.SKName], err = dynamodbattribute.Marshal(key.SKValue)
+		skCondition := expression.Key(key.SKName).Equal(expression.Value(rawAttribute{keyAttributes[key.SKName]}))
+		pkCondition = pkCondition.And(skCondition)
+	}
+
+	values := make(map[string]*dynamodb.AttributeValue, len(fields))
+	for fieldName, fieldValue := range fields {
+		value, err := marshaledValue(fieldValue)
 		if err != nil {
 			return err
 		}
+		values[fieldName] = value.attribute
 	}
 
-	pkCondition := expression.Key(key.PKName).Equal(expression.Value(key.PKValue))
-	if len(key.SKName) > 0 {
-		skCondition := expression.Key(key.SKName).Equal(expression.Value(key.SKValue))
-		pkCondition = pkCondition.And(skCondition)
+	if err := checkS3Pointers(values); err != nil {
+		return err
 	}
 
+	offloadNames := s3OffloadFieldsOfTable(tablename)
+	if s3Offload != nil && offloadNames == nil {
+		// the attributes cannot be offloaded without the registration, so the offloaded ones are not overwritten
+		for fieldName := range fields {
+			condition = And(condition, AttributeNotExists(fieldName+"."+s3PointerAttributeName))
+		}
+	}
+
+	values, offloaded, err := offloadAttributes(offloadNames, values)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			deleteOffloadedObjects(offloaded)
+		}
+	}()
+
+	updatedAttributes := copyAttributes(keyAttributes)
+
 	updateBuilder := expression.UpdateBuilder{}
-	for fieldName, fieldValue := range fields {
-		updateBuilder = updateBuilder.Set(expression.Name(fieldName), expression.Value(fieldValue))
+	for fieldName, value := range values {
+		updatedAttributes[fieldName] = value
+		updateBuilder = updateBuilder.Set(expression.Name(fieldName), expression.Value(rawAttribute{value}))
+	}
+
+	if audit := auditFieldsOfTable(tablename); len(audit.UpdatedAt) > 0 {
+		if _, ok := fields[audit.UpdatedAt]; !ok {
+			updatedAt, err := auditTimestamp(audit.UpdatedAtType, time.Now())
+			if err != nil {
+				return err
+			}
+			updatedAttributes[audit.UpdatedAt] = updatedAt
+			updateBuilder = updateBuilder.Set(expression.Name(audit.UpdatedAt), expression.Value(rawAttribute{updatedAt}))
+		}
+	}
+
+	updatedNames := []string{}
+	for name := range updatedAttributes {
+		if _, isKey := keyAttributes[name]; !isKey {
+			updatedNames = append(updatedNames, name)
+		}
+	}
+
+	condition = And(condition, notBreakingSignature(updatedNames))
+
+	if itemValidation {
+		// only the key and the attributes being set, updatedAt included, are known
+		if err := validateItem("UpdateItem", updatedAttributes, key.PKName, key.SKName); err != nil {
+			return err
+		}
 	}
 
 	expr, err := expression.NewBuilder().WithKeyCondition(pkCondition).WithUpdate(updateBuilder).Build()
@@ -64,16 +155,75 @@ func UpdateItem(tablename string, key Key, fields map[string]interface{}) (err e
 		return err
 	}
 
+	encodedCondition, err := condition.encode()
+	if err != nil {
+		return err
+	}
+
+	names, values := mergePlaceholders(expr.Names(), expr.Values(), encodedCondition)
+
 	input := &dynamodb.UpdateItemInput{
-		ExpressionAttributeNames:  expr.Names(),
-		ExpressionAttributeValues: expr.Values(),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
 		TableName:                 aws.String(tablename),
 		Key:                       keyAttributes,
-		ConditionExpression:       expr.KeyCondition(),
+		ConditionExpression:       mergeExpression(expr.KeyCondition(), encodedCondition.Expression),
 		UpdateExpression:          expr.Update(),
 	}
 
-	_, err = svc.UpdateItem(input)
+	if s3Offload != nil {
+		input.ReturnValues = aws.String(dynamodb.ReturnValueUpdatedOld)
+	}
+
+	output, err := svc.UpdateItem(input)
+
+	invalidateCachedKey(tablename, keyAttributes)
+
+	if err != nil {
+		return explainUpdateFailure(tablename, keyAttributes, updatedNames, err)
+	}
+
+	// the attributes overwritten may have been offloaded to s3
+	return deleteOffloadedObjects(offloadedObjects(output.Attributes, nil))
+}
+
+// explainUpdateFailure replaces the ConditionalCheckFailedException of UpdateItemIf caused by the conditions
+// the package adds to the update by a descriptive error. The other errors are returned as they are.
+func explainUpdateFailure(tablename string, keyAttributes map[string]*dynamodb.AttributeValue, names []string, err error) error {
+	if !isConditionalCheckFailed(err) {
+		return err
+	}
+
+	output, getErr := newClient().GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(tablename),
+		Key:            keyAttributes,
+		ConsistentRead: aws.Bool(true),
+	})
+	if getErr != nil {
+		return err
+	}
+
+	if metadata := output.Item[encryptionAttributeName]; metadata != nil && metadata.M != nil {
+		unsigned := make(map[string]bool)
+		if metadata.M["unsigned"] != nil {
+			for _, name := range metadata.M["unsigned"].SS {
+				unsigned[*name] = true
+			}
+		}
+		for _, name := range names {
+			if !unsigned[name] {
+				return errors.New("dynamodbutils.UpdateItem: the item is signed and its attribute '" + name + "' can only be changed by PutItem")
+			}
+		}
+	}
+
+	if s3Offload != nil && s3OffloadFieldsOfTable(tablename) == nil {
+		for _, name := range names {
+			if _, ok := parseS3Pointer(output.Item[name]); ok {
+				return errors.New("dynamodbutils.UpdateItem: the attribute '" + name + "' is offloaded to s3 and the table was not registered with RegisterS3OffloadFields")
+			}
+		}
+	}
 
 	return err
 }
@@ -81,28 +231,52 @@ func UpdateItem(tablename string, key Key, fields map[string]interface{}) (err e
 // DeleteItem - deletes an item from dynamodb
 // Note: this function won't return error if the item was not found on the table.
 func DeleteItem(tablename string, key Key) (err error) {
-	svc := dynamodb.New(sessionutils.Session)
+	return DeleteItemIf(tablename, key, Condition{})
+}
 
-	keyAttributes := make(map[string]*dynamodb.AttributeValue)
+// DeleteItemIf deletes an item from dynamodb only if it matches the given condition.
+//
+// Example:
+//
+// err := DeleteItemIf(tablename, key, Eq("Status", "CANCELLED"))
+//
+// The errors returned are:
+//   - ConditionalCheckFailedException: the item does not match the condition.
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/dynamodb/#DynamoDB.DeleteItem
+func DeleteItemIf(tablename string, key Key, condition Condition) (err error) {
+	svc := newClient()
 
-	keyAttributes[key.PKName], err = dynamodbattribute.Marshal(key.PKValue)
+	keyAttributes, err := marshalKey(key)
 	if err != nil {
 		return err
 	}
 
-	if len(key.SKName) > 0 {
-		keyAttributes[key.SKName], err = dynamodbattribute.Marshal(key.SKValue)
-		if err != nil {
-			return err
-		}
+	encodedCondition, err := condition.encode()
+	if err != nil {
+		return err
 	}
 
-	_, err = svc.DeleteItem(&dynamodb.DeleteItemInput{
-		TableName: &tablename,
-		Key:       keyAttributes,
-	})
+	input := &dynamodb.DeleteItemInput{
+		TableName:                 &tablename,
+		Key:                       keyAttributes,
+		ConditionExpression:       encodedCondition.Expression,
+		ExpressionAttributeNames:  encodedCondition.Names,
+		ExpressionAttributeValues: encodedCondition.Values,
+	}
 
-	return err
+	if s3Offload != nil {
+		input.ReturnValues = aws.String(dynamodb.ReturnValueAllOld)
+	}
+
+	output, err := svc.DeleteItem(input)
+
+	invalidateCachedKey(tablename, keyAttributes)
+
+	if err != nil {
+		return err
+	}
+
+	return deleteOffloadedObjects(offloadedObjects(output.Attributes, s3OffloadFieldsOfTable(tablename)))
 }
 
 // GetItem retrieves from the table the item identified by its partition key (and sort key if given)
@@ -136,35 +310,79 @@ func DeleteItem(tablename string, key Key) (err error) {
 //		 This error indicates that the database was queried successfully but the item does not exist.
 //		 Note: use 'err.Error() == "ItemNotFoundException"' to identify this error.
 //     - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/dynamodb/#DynamoDB.GetItem
+//
+// If a cache was configured with SetCache the item is read from the cache when present there.
+//
+// The attributes not mapped to any field of the struct are ignored. Use SetMarshalingOptions with
+// MarshalingOptions.Strict to get an error instead.
 func GetItem(tablename string, key Key, pointerToOutputObject interface{}) (err error) {
-	svc := dynamodb.New(sessionutils.Session)
-
-	keyAttributes := make(map[string]*dynamodb.AttributeValue)
+	return GetItemWithOptions(tablename, key, pointerToOutputObject, ReadOptions{})
+}
 
-	keyAttributes[key.PKName], err = dynamodbattribute.Marshal(key.PKValue)
+// GetItemWithOptions works like GetItem() but allows reading only some of the item's attributes
+// and making strongly consistent reads. See ReadOptions.
+//
+// Example:
+//
+// err = GetItemWithOptions(tablename, key, &person, ReadOptions{ProjectFromOutput: true})
+func GetItemWithOptions(tablename string, key Key, pointerToOutputObject interface{}, opts ReadOptions) (err error) {
+	keyAttributes, err := marshalKey(key)
 	if err != nil {
 		return err
 	}
 
-	if len(key.SKName) > 0 {
-		keyAttributes[key.SKName], err = dynamodbattribute.Marshal(key.SKValue)
+	var item map[string]*dynamodb.AttributeValue
+	var found bool
+
+	if opts.usesCache() {
+		item, found = getCachedItem(tablename, keyAttributes)
+	}
+
+	if !found {
+		generation := currentCacheGeneration(tablename, keyAttributes)
+
+		svc := newClient()
+
+		input := &dynamodb.GetItemInput{
+			Key:            keyAttributes,
+			TableName:      aws.String(tablename),
+			ConsistentRead: aws.Bool(opts.ConsistentRead),
+		}
+
+		projection, hasProjection := buildProjection(opts.projectionAttributes(reflect.TypeOf(pointerToOutputObject)))
+		if hasProjection {
+			expr, err := expression.NewBuilder().WithProjection(projection).Build()
+			if err != nil {
+				return err
+			}
+			input.ProjectionExpression = expr.Projection()
+			input.ExpressionAttributeNames = expr.Names()
+		}
+
+		getItemOutput, err := svc.GetItem(input)
 		if err != nil {
 			return err
 		}
+
+		item = getItemOutput.Item
+		if len(item) == 0 {
+			item = nil
+		}
+
+		if !hasProjection {
+			cacheItem(tablename, key, keyAttributes, item, generation)
+		}
 	}
 
-	getItemOutput, err := svc.GetItem(&dynamodb.GetItemInput{
-		Key:       keyAttributes,
-		TableName: aws.String(tablename),
-	})
-	if err != nil {
-		return err
+	if item == nil {
+		return errors.New("ItemNotFoundException")
 	}
-	if len(getItemOutput.Item) == 0 {
+
+	if isSoftDeleted(item, opts.deletedAtAttribute(reflect.TypeOf(pointerToOutputObject))) {
 		return errors.New("ItemNotFoundException")
 	}
 
-	err = dynamodbattribute.UnmarshalMap(getItemOutput.Item, pointerToOutputObject)
+	err = unmarshalItem(tablename, item, pointerToOutputObject, opts.projects(reflect.TypeOf(pointerToOutputObject)))
 
 	return err
 }
@@ -181,15 +399,32 @@ func GetItem(tablename string, key Key, pointerToOutputObject interface{}) (err
 //		 Note: use 'err.Error() == "MultipleItemsFound"' to identify this error.
 //     - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/dynamodb/#DynamoDB.GetItem
 func FindOneFromIndex(tablename string, indexname string, key Key, pointerToOutputObject interface{}) (err error) {
-	svc := dynamodb.New(sessionutils.Session)
+	return FindOneFromIndexWithOptions(tablename, indexname, key, pointerToOutputObject, ReadOptions{})
+}
 
-	keyCondition := expression.Key(key.PKName).Equal(expression.Value(key.PKValue))
+// FindOneFromIndexWithOptions works like FindOneFromIndex() but allows reading only some of the item's
+// attributes and making strongly consistent reads (local secondary indexes only). See ReadOptions.
+func FindOneFromIndexWithOptions(tablename string, indexname string, key Key, pointerToOutputObject interface{}, opts ReadOptions) (err error) {
+	svc := newClient()
+
+	keyAttributes, err := marshalKey(key)
+	if err != nil {
+		return err
+	}
+
+	keyCondition := expression.Key(key.PKName).Equal(expression.Value(rawAttribute{keyAttributes[key.PKName]}))
 
 	if len(key.SKName) > 0 {
-		keyCondition = expression.KeyAnd(keyCondition, expression.Key(key.SKName).Equal(expression.Value(key.SKValue)))
+		keyCondition = expression.KeyAnd(keyCondition, expression.Key(key.SKName).Equal(expression.Value(rawAttribute{keyAttributes[key.SKName]})))
 	}
 
-	expr, err := expression.NewBuilder().WithKeyCondition(keyCondition).Build()
+	builder := expression.NewBuilder().WithKeyCondition(keyCondition)
+
+	if projection, ok := buildProjection(opts.projectionAttributes(reflect.TypeOf(pointerToOutputObject))); ok {
+		builder = builder.WithProjection(projection)
+	}
+
+	expr, err := builder.Build()
 
 	if err != nil {
 		return err
@@ -199,26 +434,41 @@ func FindOneFromIndex(tablename string, indexname string, key Key, pointerToOutp
 		TableName:                 &tablename,
 		IndexName:                 &indexname,
 		KeyConditionExpression:    expr.KeyCondition(),
+		ProjectionExpression:      expr.Projection(),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
+		ConsistentRead:            aws.Bool(opts.ConsistentRead),
 	})
 	if err != nil {
 		return err
 	}
 
-	if len(queryOutput.Items) == 0 {
+	items := []map[string]*dynamodb.AttributeValue{}
+	for _, item := range queryOutput.Items {
+		if !isSoftDeleted(item, opts.deletedAtAttribute(reflect.TypeOf(pointerToOutputObject))) {
+			items = append(items, item)
+		}
+	}
+
+	if len(items) == 0 {
 		return errors.New("ItemNotFoundException")
-	} else if len(queryOutput.Items) > 1 {
+	} else if len(items) > 1 {
 		return errors.New("MultipleItemsFound")
 	}
 
-	err = dynamodbattribute.UnmarshalMap(queryOutput.Items[0], pointerToOutputObject)
+	err = unmarshalItem(tablename, items[0], pointerToOutputObject, opts.projects(reflect.TypeOf(pointerToOutputObject)))
 
 	return err
 }
 
 // PutItem creates or replaces an Item on a Dynamodb table.
 // The given item must be a struct or a map[string]interface{} instance
+//
+// If the item's struct has audit fields (see RegisterAuditFields) its updatedAt attribute is set to the
+// current time, and its createdAt attribute too when the item is new. The existing createdAt is kept
+// when the item is replaced, which makes PutItem read it first with a consistent GetItem: the write
+// consumes the read capacity of the item too and takes two requests. When the createdAt field of the item
+// is set, its value is written as is, with a single request.
 func PutItem(tablename string, item interface{}) error {
 	return PutItemWithConditional(tablename, item, "", nil)
 }
@@ -228,38 +478,100 @@ func PutItem(tablename string, item interface{}) error {
 // queryConditional := "deleted = :deleted"
 // valuesConditional := map[string]interface{}{":deleted": false}
 // err := dynamodbutils.PutItemWithConditional(PROMOTION_TABLE_NAME, promotionPersisted, queryConditional, valuesConditional)
+//
+// Prefer PutItemIf, which builds the expression and its placeholders from a Condition.
 func PutItemWithConditional(tablename string, item interface{}, conditionalExpression string, conditionalValues map[string]interface{}) error {
-	dynamoItem, err := dynamodbattribute.MarshalMap(item)
+	var condition encodedCondition
+
+	if len(conditionalExpression) > 0 {
+		condition.Expression = &conditionalExpression
+	}
+
+	if len(conditionalValues) > 0 {
+		var err error
+		condition.Values, err = marshalMap(conditionalValues)
+		if err != nil {
+			return err
+		}
+	}
+
+	return putItem(tablename, item, condition)
+}
+
+// PutItemIf creates or replaces an Item, like PutItem, only if the existing item matches the given condition.
+//
+// Example:
+//
+// // creates the item only if it does not exist yet
+// err := PutItemIf(tablename, city, AttributeNotExists("State"))
+//
+// // replaces the item only if it was not changed since it was read
+// err := PutItemIf(tablename, order, Eq("Version", order.Version-1))
+//
+// The errors returned are:
+//   - ConditionalCheckFailedException: the existing item does not match the condition.
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/dynamodb/#DynamoDB.PutItem
+func PutItemIf(tablename string, item interface{}, condition Condition) error {
+	encodedCondition, err := condition.encode()
 	if err != nil {
 		return err
 	}
 
-	var putItemInput *dynamodb.PutItemInput
+	return putItem(tablename, item, encodedCondition)
+}
 
-	var condExp *string
-	if len(conditionalExpression) > 0 {
-		condExp = &conditionalExpression
+func putItem(tablename string, item interface{}, condition encodedCondition) error {
+	dynamoItem, offloaded, err := marshalItem(tablename, item)
+	if err != nil {
+		return err
 	}
 
-	var condValues map[string]*dynamodb.AttributeValue
-	if len(conditionalValues) > 0 {
-		condValues, err = dynamodbattribute.MarshalMap(conditionalValues)
+	if itemValidation {
+		pkName, skName, err := tableKeyNames(tablename)
+		if err == nil {
+			err = validateItem("PutItem", dynamoItem, pkName, skName)
+		}
 		if err != nil {
+			deleteOffloadedObjects(offloaded)
 			return err
 		}
 	}
 
-	putItemInput = &dynamodb.PutItemInput{
+	putItemInput := &dynamodb.PutItemInput{
 		TableName:                 aws.String(tablename),
 		Item:                      dynamoItem,
-		ConditionExpression:       condExp,
-		ExpressionAttributeValues: condValues,
+		ConditionExpression:       condition.Expression,
+		ExpressionAttributeNames:  condition.Names,
+		ExpressionAttributeValues: condition.Values,
 	}
 
-	dynamodbClient := dynamodb.New(sessionutils.Session)
-	_, err = dynamodbClient.PutItem(putItemInput)
+	var oldAttributes map[string]*dynamodb.AttributeValue
 
-	return err
+	if fields := auditFieldsOf(reflect.TypeOf(item)); len(fields.CreatedAt) > 0 && !createdAtSupplied(item, fields) {
+		oldAttributes, err = putItemKeepingCreatedAt(tablename, dynamoItem, fields.CreatedAt, condition)
+	} else {
+		if s3Offload != nil {
+			putItemInput.ReturnValues = aws.String(dynamodb.ReturnValueAllOld)
+		}
+
+		var output *dynamodb.PutItemOutput
+
+		dynamodbClient := newClient()
+		output, err = dynamodbClient.PutItem(putItemInput)
+		if err == nil {
+			oldAttributes = output.Attributes
+		}
+	}
+
+	invalidateCachedItem(tablename, dynamoItem)
+
+	if err != nil {
+		deleteOffloadedObjects(offloaded)
+		return err
+	}
+
+	// the attributes of the replaced item may have been offloaded to s3
+	return deleteOffloadedObjects(offloadedObjects(oldAttributes, offloadedAttributeNames(reflect.TypeOf(item))))
 }
 
 // KeyCondition allows you set the parameters for a query with 'key condition expression'
@@ -274,6 +586,9 @@ func PutItemWithConditional(tablename string, item interface{}, conditionalExpre
 //   - SKValueGreaterThan: selects items having the sort key value greater than the given value
 //   - SKValueGreaterThanEqual: selects items having the sort key value greater than or equal to the the given value
 //   - SKValueBetweenStart and SKValueBetweenEnd: selects items having the sort key value between the given limits, including the limiting items.
+//   - IncludeDeleted: when true the items marked as deleted by SoftDelete are returned too.
+//   - Filter: selects, among the items found by the key condition, the ones matching the given condition.
+//     The items filtered out still consume read capacity.
 type KeyCondition struct {
 	IndexName               string      // optional
 	PKName                  string      // mandatory
@@ -286,17 +601,19 @@ type KeyCondition struct {
 	SKValueGreaterThanEqual interface{} // optional
 	SKValueBetweenStart     interface{} // optional
 	SKValueBetweenEnd       interface{} // optional
+	IncludeDeleted          bool        // optional
+	Filter                  Condition   // optional
 }
 
 // Runs the query specified by the keyCondition argument on the given table or index and fills the slice
-// pointed by 'pointerToOutputSlice' with the items found, if any.
+// pointed by 'pointerToOutputSlice' with the items found, if any. All the pages of the results are read.
 func Query(tablename string, keyCondition KeyCondition, pointerToOuputSlice interface{}) (err error) {
 	rv := reflect.ValueOf(pointerToOuputSlice)
 	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
 		return fmt.Errorf("dynamodbutils.Query: pointerToOutputSlice must be a slice pointer")
 	}
 
-	dynamodbClient := dynamodb.New(sessionutils.Session)
+	dynamodbClient := newClient()
 
 	attributeValues := make(map[string]*dynamodb.AttributeValue)
 	attributeNames := make(map[string]*string)
@@ -305,7 +622,7 @@ func Query(tablename string, keyCondition KeyCondition, pointerToOuputSlice inte
 
 	attributeNames["#pkname"] = &keyCondition.PKName
 
-	attributeValues[":pkval"], err = dynamodbattribute.Marshal(keyCondition.PKValue)
+	attributeValues[":pkval"], err = marshalValue(keyCondition.PKValue)
 	if err != nil {
 		return err
 	}
@@ -317,30 +634,30 @@ func Query(tablename string, keyCondition KeyCondition, pointerToOuputSlice inte
 
 		if keyCondition.SKValueEqual != nil {
 			keyConditionExpression = keyConditionExpression + " and #skname = :skval"
-			attributeValues[":skval"], err = dynamodbattribute.Marshal(keyCondition.SKValueEqual)
+			attributeValues[":skval"], err = marshalValue(keyCondition.SKValueEqual)
 
 		} else if keyCondition.SKValueBetweenStart != nil && keyCondition.SKValueBetweenEnd != nil {
 			keyConditionExpression = keyConditionExpression + " and #skname BETWEEN :skval1 AND :skval2"
-			attributeValues[":skval1"], err = dynamodbattribute.Marshal(keyCondition.SKValueBetweenStart)
+			attributeValues[":skval1"], err = marshalValue(keyCondition.SKValueBetweenStart)
 			if err == nil {
-				attributeValues[":skval2"], err = dynamodbattribute.Marshal(keyCondition.SKValueBetweenEnd)
+				attributeValues[":skval2"], err = marshalValue(keyCondition.SKValueBetweenEnd)
 			}
 
 		} else if keyCondition.SKValueGreaterThan != nil {
 			keyConditionExpression = keyConditionExpression + " and #skname > :skval"
-			attributeValues[":skval"], err = dynamodbattribute.Marshal(keyCondition.SKValueGreaterThan)
+			attributeValues[":skval"], err = marshalValue(keyCondition.SKValueGreaterThan)
 
 		} else if keyCondition.SKValueGreaterThanEqual != nil {
 			keyConditionExpression = keyConditionExpression + " and #skname >= :skval"
-			attributeValues[":skval"], err = dynamodbattribute.Marshal(keyCondition.SKValueGreaterThanEqual)
+			attributeValues[":skval"], err = marshalValue(keyCondition.SKValueGreaterThanEqual)
 
 		} else if keyCondition.SKValueLessThan != nil {
 			keyConditionExpression = keyConditionExpression + " and #skname < :skval"
-			attributeValues[":skval"], err = dynamodbattribute.Marshal(keyCondition.SKValueLessThan)
+			attributeValues[":skval"], err = marshalValue(keyCondition.SKValueLessThan)
 
 		} else if keyCondition.SKValueLessThanEqual != nil {
 			keyConditionExpression = keyConditionExpression + " and #skname <= :skval"
-			attributeValues[":skval"], err = dynamodbattribute.Marshal(keyCondition.SKValueLessThanEqual)
+			attributeValues[":skval"], err = marshalValue(keyCondition.SKValueLessThanEqual)
 
 		} else {
 			return errors.New("keyCondition is invalid")
@@ -361,69 +678,113 @@ func Query(tablename string, keyCondition KeyCondition, pointerToOuputSlice inte
 		queryInput.IndexName = &keyCondition.IndexName
 	}
 
-	queryOutput, err := dynamodbClient.Query(&queryInput)
+	filterCondition := keyCondition.Filter
+	if deletedAt := auditFieldsOf(rv.Type()).DeletedAt; len(deletedAt) > 0 && !keyCondition.IncludeDeleted {
+		filterCondition = And(filterCondition, notSoftDeletedCondition(deletedAt))
+	}
+
+	filter, err := filterCondition.encode()
+	if err != nil {
+		return err
+	}
+
+	queryInput.FilterExpression = mergeExpression(queryInput.FilterExpression, filter.Expression)
+	queryInput.ExpressionAttributeNames, queryInput.ExpressionAttributeValues = mergePlaceholders(attributeNames, attributeValues, filter)
+
+	items := []map[string]*dynamodb.AttributeValue{}
+
+	err = dynamodbClient.QueryPages(&queryInput, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		items = append(items, page.Items...)
+		return true
+	})
 
 	if err != nil {
 		return err
 	}
 
-	if len(queryOutput.Items) == 0 {
+	if len(items) == 0 {
 		return nil
 	}
 
-	err = dynamodbattribute.UnmarshalListOfMaps(queryOutput.Items, pointerToOuputSlice)
+	err = unmarshalItems(tablename, items, pointerToOuputSlice, false)
 
 	return err
 }
 
-// Retrieves a list of items identified by their keys from the given table and fills the slice
-// pointed by 'pointerToOutputSlice' with the items found, if any
-func BatchGetItem(tablename string, keys []Key, pointerToOuputSlice interface{}) (err error) {
-	rv := reflect.ValueOf(pointerToOuputSlice)
+// Scan reads all the items of the table matching the filter and fills the slice pointed by 'pointerToOutputSlice'
+// with them. An empty filter (Condition{}) returns all the items. All the pages of the results are read.
+//
+// A scan reads the whole table, consuming read capacity for every item, including the ones filtered out.
+// The items marked as deleted by SoftDelete are skipped when the output type has a deletedAt field.
+//
+// Example:
+//
+// cities := []City{}
+//
+// err := Scan(tablename, And(Eq("State", "MG"), BeginsWith("Name", "Belo")), &cities)
+func Scan(tablename string, filter Condition, pointerToOutputSlice interface{}) (err error) {
+	rv := reflect.ValueOf(pointerToOutputSlice)
 	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
-		return fmt.Errorf("dynamodbutils.BatchGetItem: pointerToOutputSlice must be a slice pointer")
+		return fmt.Errorf("dynamodbutils.Scan: pointerToOutputSlice must be a slice pointer")
 	}
 
-	dynamodbClient := dynamodb.New(sessionutils.Session)
-
-	keyAttributesListOfMaps := []map[string]*dynamodb.AttributeValue{}
-
-	for _, key := range keys {
-		keyAttributesMap := make(map[string]*dynamodb.AttributeValue)
-
-		keyAttributesMap[key.PKName], err = dynamodbattribute.Marshal(key.PKValue)
-		if err != nil {
-			return err
-		}
-
-		if len(key.SKName) > 0 {
-			keyAttributesMap[key.SKName], err = dynamodbattribute.Marshal(key.SKValue)
-			if err != nil {
-				return err
-			}
-		}
+	if deletedAt := auditFieldsOf(rv.Type()).DeletedAt; len(deletedAt) > 0 {
+		filter = And(filter, notSoftDeletedCondition(deletedAt))
+	}
 
-		keyAttributesListOfMaps = append(keyAttributesListOfMaps, keyAttributesMap)
+	encodedFilter, err := filter.encode()
+	if err != nil {
+		return err
 	}
 
-	input := &dynamodb.BatchGetItemInput{
-		RequestItems: map[string]*dynamodb.KeysAndAttributes{
-			tablename: {
-				Keys: keyAttributesListOfMaps,
-			},
-		},
+	scanInput := dynamodb.ScanInput{
+		TableName:                 &tablename,
+		FilterExpression:          encodedFilter.Expression,
+		ExpressionAttributeNames:  encodedFilter.Names,
+		ExpressionAttributeValues: encodedFilter.Values,
 	}
 
-	result, err := dynamodbClient.BatchGetItem(input)
+	items := []map[string]*dynamodb.AttributeValue{}
+
+	err = newClient().ScanPages(&scanInput, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		items = append(items, page.Items...)
+		return true
+	})
+
 	if err != nil {
 		return err
 	}
 
-	resultsForThisTable := result.Responses[tablename]
-
-	if len(resultsForThisTable) > 0 {
-		err = dynamodbattribute.UnmarshalListOfMaps(resultsForThisTable, pointerToOuputSlice)
+	if len(items) == 0 {
+		return nil
 	}
 
-	return err
+	return unmarshalItems(tablename, items, pointerToOutputSlice, false)
+}
+
+// Retrieves a list of items identified by their keys from the given table and fills the slice
+// pointed by 'pointerToOutputSlice' with the items found, if any, in the same order of the keys.
+//
+// The keys are read in groups of 100, the limit of the dynamodb api, and the keys left unprocessed by
+// dynamodb (e.g. when the table's capacity is exceeded) are read again with exponential backoff.
+//
+// If a cache was configured with SetCache only the items not present on the cache are read from the table.
+//
+// The errors returned are:
+//   - UnprocessedKeysException: some of the keys were still unprocessed after all the retries.
+//     Note: use 'err.Error() == "UnprocessedKeysException"' to identify this error.
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/dynamodb/#DynamoDB.BatchGetItem
+func BatchGetItem(tablename string, keys []Key, pointerToOuputSlice interface{}) (err error) {
+	return BatchGetItemWithOptions(tablename, keys, pointerToOuputSlice, ReadOptions{})
+}
+
+// BatchGetItemWithOptions works like BatchGetItem() but allows reading only some of the items' attributes
+// and making strongly consistent reads. See ReadOptions.
+func BatchGetItemWithOptions(tablename string, keys []Key, pointerToOuputSlice interface{}, opts ReadOptions) (err error) {
+	return BatchGetItems([]BatchGetRequest{{
+		TableName:            tablename,
+		Keys:                 keys,
+		PointerToOutputSlice: pointerToOuputSlice,
+		Options:              opts,
+	}})
 }
@@ -12,6 +12,7 @@ import (
 	"github.com/AmeDigital/aws-utils-go/sessionutils"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
@@ -39,11 +40,21 @@ func TestMain(m *testing.M) {
 	}
 
 	// cria recursos no localstack,
-	err := localstack.StartLocalstack2(localstack.Services.DynamoDB)
+	err := localstack.StartLocalstack2(localstack.Services.DynamoDB, localstack.Services.S3)
 	check(err)
 
-	// configures dynamodb client to use localstack
-	awsConfigForDynamodb := aws.Config{Endpoint: aws.String("http://localhost:4569"), Region: aws.String("us-east-1")}
+	// configures dynamodb client to use localstack, and s3 for the offloaded attributes
+	resolver := endpoints.ResolverFunc(func(service, region string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+		switch service {
+		case endpoints.DynamodbServiceID:
+			return endpoints.ResolvedEndpoint{URL: localstack.Services.DynamoDB.EndpointUrl(), SigningRegion: region}, nil
+		case endpoints.S3ServiceID:
+			return endpoints.ResolvedEndpoint{URL: localstack.Services.S3.EndpointUrl(), SigningRegion: region}, nil
+		}
+		return endpoints.DefaultResolver().EndpointFor(service, region, opts...)
+	})
+
+	awsConfigForDynamodb := aws.Config{EndpointResolver: resolver, Region: aws.String("us-east-1"), S3ForcePathStyle: aws.Bool(true)}
 	dynamodbSessionForLocalstack, err := session.NewSession(&awsConfigForDynamodb)
 	sessionutils.Session = dynamodbSessionForLocalstack
 	check(err)
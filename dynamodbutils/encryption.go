@@ -0,0 +1,544 @@
+package dynamodbutils
+
+import (
+	"container/list"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/AmeDigital/aws-utils-go/sessionutils"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+// KeyProvider supplies the data keys used to encrypt the attributes of the items (envelope encryption):
+// each item is encrypted with its own data key, which is stored on the item encrypted by a master key.
+type KeyProvider interface {
+	// GenerateDataKey returns a new 256 bits data key, in plaintext and encrypted by the master key.
+	GenerateDataKey() (plaintextKey []byte, encryptedKey []byte, err error)
+	// DecryptDataKey decrypts a data key returned by GenerateDataKey.
+	DecryptDataKey(encryptedKey []byte) (plaintextKey []byte, err error)
+}
+
+var keyProvider KeyProvider
+
+// SetEncryption enables the client side encryption of the struct fields tagged with `dynamodbutils:"encrypt"`.
+// Use SetEncryption(nil) to disable it.
+//
+// The tagged attributes are encrypted by PutItem and decrypted by GetItem, FindOneFromIndex, Query and
+// BatchGetItem. Every item written by PutItem is also signed, so reading an item whose attributes were
+// changed outside of PutItem fails with an error, and UpdateItem refuses to change its signed attributes.
+// The audit attributes (see RegisterAuditFields) are the exception: they are not signed, so UpdateItem can
+// set them and SoftDelete can be used. The last 1000 data keys decrypted are kept in memory, so reading an
+// item again, from the cache of GetItem included, does not call the KeyProvider. The attributes used as keys of the
+// table or of its indexes must not be tagged, since dynamodb must be able to read them: PutItem fails if they are.
+//
+// Example:
+//
+//	type Customer struct {
+//	    Id       string
+//	    Document string `dynamodbutils:"encrypt"`
+//	}
+//
+// SetEncryption(NewKMSKeyProvider("alias/customers"))
+func SetEncryption(provider KeyProvider) {
+	dataKeyCache.Lock()
+	defer dataKeyCache.Unlock()
+
+	keyProvider = provider
+	dataKeyCache.keys = make(map[string][]byte)
+	dataKeyCache.order = list.New()
+}
+
+// dataKeyCacheSize is the number of decrypted data keys kept in memory.
+const dataKeyCacheSize = 1000
+
+// dataKeyCache holds the data keys decrypted by the KeyProvider, by their encrypted form. The oldest keys
+// are discarded first.
+var dataKeyCache = struct {
+	sync.Mutex
+	keys  map[string][]byte
+	order *list.List
+}{keys: make(map[string][]byte), order: list.New()}
+
+// decryptDataKey decrypts a data key with the provider, or takes it from the cache.
+func decryptDataKey(provider KeyProvider, encryptedKey []byte) ([]byte, error) {
+	dataKeyCache.Lock()
+	dataKey, ok := dataKeyCache.keys[string(encryptedKey)]
+	dataKeyCache.Unlock()
+	if ok {
+		return dataKey, nil
+	}
+
+	dataKey, err := provider.DecryptDataKey(encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKeyCache.Lock()
+	defer dataKeyCache.Unlock()
+
+	if _, ok := dataKeyCache.keys[string(encryptedKey)]; !ok {
+		dataKeyCache.keys[string(encryptedKey)] = dataKey
+		dataKeyCache.order.PushBack(string(encryptedKey))
+		if dataKeyCache.order.Len() > dataKeyCacheSize {
+			oldest := dataKeyCache.order.Remove(dataKeyCache.order.Front()).(string)
+			delete(dataKeyCache.keys, oldest)
+		}
+	}
+
+	return dataKey, nil
+}
+
+// notBreakingSignature is the condition that the attributes set by UpdateItem do not invalidate the signature
+// of the item: the item was not signed, or all the attributes are left out of its signature.
+func notBreakingSignature(names []string) Condition {
+	unsigned := []Condition{}
+	for _, name := range names {
+		unsigned = append(unsigned, Contains(encryptionAttributeName+".unsigned", name))
+	}
+
+	return Or(AttributeNotExists(encryptionAttributeName), And(unsigned...))
+}
+
+// NewKMSKeyProvider creates a KeyProvider that generates the data keys with the given KMS key.
+func NewKMSKeyProvider(keyId string) KeyProvider {
+	return &kmsKeyProvider{keyId: keyId}
+}
+
+type kmsKeyProvider struct {
+	keyId string
+}
+
+func (p *kmsKeyProvider) GenerateDataKey() (plaintextKey []byte, encryptedKey []byte, err error) {
+	svc := kms.New(sessionutils.Session)
+
+	output, err := svc.GenerateDataKey(&kms.GenerateDataKeyInput{
+		KeyId:   aws.String(p.keyId),
+		KeySpec: aws.String(kms.DataKeySpecAes256),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return output.Plaintext, output.CiphertextBlob, nil
+}
+
+func (p *kmsKeyProvider) DecryptDataKey(encryptedKey []byte) (plaintextKey []byte, err error) {
+	svc := kms.New(sessionutils.Session)
+
+	output, err := svc.Decrypt(&kms.DecryptInput{
+		KeyId:          aws.String(p.keyId),
+		CiphertextBlob: encryptedKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Plaintext, nil
+}
+
+// NewLocalKeyProvider creates a KeyProvider that encrypts the data keys with a master key held in memory.
+// It is meant for tests and local development. The master key must have 16, 24 or 32 bytes.
+func NewLocalKeyProvider(masterKey []byte) (KeyProvider, error) {
+	aead, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return &localKeyProvider{aead: aead}, nil
+}
+
+type localKeyProvider struct {
+	aead cipher.AEAD
+}
+
+func (p *localKeyProvider) GenerateDataKey() (plaintextKey []byte, encryptedKey []byte, err error) {
+	plaintextKey = make([]byte, 32)
+	if _, err = io.ReadFull(rand.Reader, plaintextKey); err != nil {
+		return nil, nil, err
+	}
+
+	encryptedKey, err = seal(p.aead, plaintextKey, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return plaintextKey, encryptedKey, nil
+}
+
+func (p *localKeyProvider) DecryptDataKey(encryptedKey []byte) (plaintextKey []byte, err error) {
+	return open(p.aead, encryptedKey, nil)
+}
+
+// encryptionAttributeName is the attribute holding the encryption metadata of an item:
+//   - key: the encrypted data key
+//   - attributes: the names of the encrypted attributes
+//   - signed: the names of the attributes covered by the signature
+//   - unsigned: the names of the audit attributes, which may change without invalidating the signature
+//   - signature: the HMAC-SHA256 of the table name, of the lists above and of the signed attributes
+const encryptionAttributeName = "dynamodbutils:encryption"
+
+// encryptAttributes encrypts the tagged attributes of the item and signs it. The item given is modified.
+func encryptAttributes(tablename string, itemType reflect.Type, item map[string]*dynamodb.AttributeValue) (map[string]*dynamodb.AttributeValue, error) {
+	provider := keyProvider
+	if provider == nil || itemType == nil {
+		return item, nil
+	}
+
+	names := taggedAttributeNames(itemType, "encrypt")
+	if len(names) == 0 {
+		return item, nil
+	}
+
+	if err := checkEncryptedKeys(tablename, names); err != nil {
+		return nil, err
+	}
+
+	dataKey, encryptedDataKey, err := provider.GenerateDataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	encryptionKey, signingKey := deriveItemKeys(dataKey)
+
+	aead, err := newAEAD(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := []*string{}
+
+	for _, name := range names {
+		attribute, ok := item[name]
+		if !ok {
+			continue
+		}
+
+		plaintext, err := json.Marshal(attribute)
+		if err != nil {
+			return nil, err
+		}
+
+		// the attribute name is authenticated, so encrypted values cannot be swapped between attributes
+		ciphertext, err := seal(aead, plaintext, []byte(name))
+		if err != nil {
+			return nil, err
+		}
+
+		item[name] = &dynamodb.AttributeValue{B: ciphertext}
+		encrypted = append(encrypted, aws.String(name))
+	}
+
+	// the audit attributes are changed by UpdateItem and SoftDelete, so they are left out of the signature
+	unsigned := make(map[string]bool)
+	for _, name := range auditFieldsOf(itemType).names() {
+		unsigned[name] = true
+	}
+
+	signed := []*string{}
+	signedItem := make(map[string]*dynamodb.AttributeValue)
+	for name, attribute := range item {
+		if !unsigned[name] {
+			signed = append(signed, aws.String(name))
+			signedItem[name] = attribute
+		}
+	}
+
+	metadata := map[string]*dynamodb.AttributeValue{
+		"key":    {B: encryptedDataKey},
+		"signed": {SS: signed},
+	}
+	if len(encrypted) > 0 {
+		metadata["attributes"] = &dynamodb.AttributeValue{SS: encrypted}
+	}
+	if len(unsigned) > 0 {
+		metadata["unsigned"] = &dynamodb.AttributeValue{SS: aws.StringSlice(auditFieldsOf(itemType).names())}
+	}
+	metadata["signature"] = &dynamodb.AttributeValue{B: signItem(signingKey, tablename, metadata, signedItem)}
+
+	item[encryptionAttributeName] = &dynamodb.AttributeValue{M: metadata}
+
+	return item, nil
+}
+
+// decryptAttributes checks the signature of an item written by encryptAttributes and returns a copy of
+// it with its attributes decrypted. Items without encryption metadata are returned as is.
+//
+// When the item was read with a projection ('projected' is true) and some of the signed attributes
+// are missing the signature cannot be checked, but the encrypted attributes are still authenticated.
+func decryptAttributes(tablename string, item map[string]*dynamodb.AttributeValue, projected bool) (map[string]*dynamodb.AttributeValue, error) {
+	metadata, ok := item[encryptionAttributeName]
+	if !ok || metadata.M == nil {
+		return item, nil
+	}
+
+	provider := keyProvider
+	if provider == nil {
+		return nil, errors.New("dynamodbutils: the item is encrypted but no KeyProvider was configured with SetEncryption")
+	}
+
+	encryptedDataKey := metadata.M["key"]
+	if encryptedDataKey == nil || encryptedDataKey.B == nil {
+		return nil, errors.New("dynamodbutils: the encryption metadata of the item has no data key")
+	}
+
+	dataKey, err := decryptDataKey(provider, encryptedDataKey.B)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptionKey, signingKey := deriveItemKeys(dataKey)
+
+	signed := make(map[string]bool)
+	if metadata.M["signed"] != nil {
+		for _, name := range metadata.M["signed"].SS {
+			signed[*name] = true
+		}
+	}
+
+	unsigned := make(map[string]bool)
+	if metadata.M["unsigned"] != nil {
+		for _, name := range metadata.M["unsigned"].SS {
+			unsigned[*name] = true
+		}
+	}
+
+	decrypted := make(map[string]*dynamodb.AttributeValue, len(item))
+	signedItem := make(map[string]*dynamodb.AttributeValue, len(item))
+
+	for name, attribute := range item {
+		if name == encryptionAttributeName {
+			continue
+		}
+		if signed[name] {
+			signedItem[name] = attribute
+		} else if !unsigned[name] {
+			return nil, errors.New("dynamodbutils: the item has the attribute '" + name + "' that was not signed, it may have been tampered with")
+		}
+		decrypted[name] = attribute
+	}
+
+	complete := len(signedItem) == len(signed)
+
+	if complete {
+		// the lists of the metadata are signed too, so no attribute can be added to them
+		signature := metadata.M["signature"]
+		if signature == nil || !hmac.Equal(signature.B, signItem(signingKey, tablename, metadata.M, signedItem)) {
+			return nil, errors.New("dynamodbutils: the signature of the item does not match, it may have been tampered with")
+		}
+	} else if !projected {
+		return nil, errors.New("dynamodbutils: the item is missing signed attributes, it may have been tampered with")
+	}
+
+	aead, err := newAEAD(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if attributes := metadata.M["attributes"]; attributes != nil {
+		for _, name := range attributes.SS {
+			attribute, ok := decrypted[*name]
+			if !ok {
+				continue
+			}
+
+			plaintext, err := open(aead, attribute.B, []byte(*name))
+			if err != nil {
+				return nil, errors.New("dynamodbutils: could not decrypt the attribute '" + *name + "': " + err.Error())
+			}
+
+			value := &dynamodb.AttributeValue{}
+			if err = json.Unmarshal(plaintext, value); err != nil {
+				return nil, err
+			}
+
+			decrypted[*name] = value
+		}
+	}
+
+	return decrypted, nil
+}
+
+// checkEncryptedKeys fails if any of the attributes to be encrypted is a key of the table or of its indexes.
+func checkEncryptedKeys(tablename string, names []string) error {
+	description, err := describeTable(tablename)
+	if err != nil {
+		return err
+	}
+
+	keySchemas := [][]*dynamodb.KeySchemaElement{description.KeySchema}
+	for _, index := range description.GlobalSecondaryIndexes {
+		keySchemas = append(keySchemas, index.KeySchema)
+	}
+	for _, index := range description.LocalSecondaryIndexes {
+		keySchemas = append(keySchemas, index.KeySchema)
+	}
+
+	for _, keySchema := range keySchemas {
+		pkName, skName := keySchemaNames(keySchema)
+		for _, name := range names {
+			if name == pkName || name == skName {
+				return errors.New("dynamodbutils: the attribute '" + name + "' is a key of the table " + tablename + " or of its indexes and cannot be encrypted")
+			}
+		}
+	}
+
+	return nil
+}
+
+// deriveItemKeys derives from the data key of an item the keys used to encrypt and to sign it.
+func deriveItemKeys(dataKey []byte) (encryptionKey []byte, signingKey []byte) {
+	mac := hmac.New(sha256.New, dataKey)
+	mac.Write([]byte("dynamodbutils encryption key"))
+	encryptionKey = mac.Sum(nil)
+
+	mac = hmac.New(sha256.New, dataKey)
+	mac.Write([]byte("dynamodbutils signing key"))
+	signingKey = mac.Sum(nil)
+
+	return encryptionKey, signingKey
+}
+
+// signItem computes the signature of the item's attributes and of the lists of attribute names of its
+// encryption metadata.
+func signItem(signingKey []byte, tablename string, metadata map[string]*dynamodb.AttributeValue, item map[string]*dynamodb.AttributeValue) []byte {
+	mac := hmac.New(sha256.New, signingKey)
+
+	writeCanonical(mac, &dynamodb.AttributeValue{S: aws.String(tablename)})
+
+	for _, list := range []string{"attributes", "signed", "unsigned"} {
+		writeCanonical(mac, &dynamodb.AttributeValue{S: aws.String(list)})
+		writeCanonical(mac, metadata[list])
+	}
+
+	names := []string{}
+	for name := range item {
+		if name != encryptionAttributeName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		writeCanonical(mac, &dynamodb.AttributeValue{S: aws.String(name)})
+		writeCanonical(mac, item[name])
+	}
+
+	return mac.Sum(nil)
+}
+
+// writeCanonical writes an attribute in a format that does not change when it is stored and read back
+// from dynamodb: the sets are sorted and the numbers are normalized.
+func writeCanonical(w io.Writer, attribute *dynamodb.AttributeValue) {
+	writeString := func(tag string, s string) {
+		io.WriteString(w, tag)
+		json.NewEncoder(w).Encode(s)
+	}
+
+	writeSorted := func(tag string, values []string) {
+		sort.Strings(values)
+		io.WriteString(w, tag)
+		json.NewEncoder(w).Encode(values)
+	}
+
+	switch {
+	case attribute == nil:
+		io.WriteString(w, "NULL\n")
+	case attribute.S != nil:
+		writeString("S", *attribute.S)
+	case attribute.N != nil:
+		writeString("N", canonicalNumber(*attribute.N))
+	case attribute.B != nil:
+		writeString("B", base64.StdEncoding.EncodeToString(attribute.B))
+	case attribute.BOOL != nil:
+		if *attribute.BOOL {
+			io.WriteString(w, "BOOL true\n")
+		} else {
+			io.WriteString(w, "BOOL false\n")
+		}
+	case attribute.NULL != nil:
+		io.WriteString(w, "NULL\n")
+	case attribute.SS != nil:
+		writeSorted("SS", aws.StringValueSlice(attribute.SS))
+	case attribute.NS != nil:
+		values := []string{}
+		for _, n := range attribute.NS {
+			values = append(values, canonicalNumber(aws.StringValue(n)))
+		}
+		writeSorted("NS", values)
+	case attribute.BS != nil:
+		values := []string{}
+		for _, b := range attribute.BS {
+			values = append(values, base64.StdEncoding.EncodeToString(b))
+		}
+		writeSorted("BS", values)
+	case attribute.L != nil:
+		io.WriteString(w, "L\n")
+		for _, element := range attribute.L {
+			writeCanonical(w, element)
+		}
+		io.WriteString(w, "END\n")
+	case attribute.M != nil:
+		names := []string{}
+		for name := range attribute.M {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		io.WriteString(w, "M\n")
+		for _, name := range names {
+			writeString("K", name)
+			writeCanonical(w, attribute.M[name])
+		}
+		io.WriteString(w, "END\n")
+	default:
+		io.WriteString(w, "EMPTY\n")
+	}
+}
+
+// canonicalNumber normalizes a number, so "1.50" and "1.5" have the same representation.
+func canonicalNumber(n string) string {
+	f, ok := new(big.Float).SetPrec(256).SetString(n)
+	if !ok {
+		return n
+	}
+	return f.Text('e', -1)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the plaintext with a random nonce, which is prepended to the ciphertext.
+func seal(aead cipher.AEAD, plaintext []byte, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts a ciphertext produced by seal.
+func open(aead cipher.AEAD, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
@@ -0,0 +1,171 @@
+package dynamodbutils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type Customer struct {
+	State    string
+	Id       int
+	Name     string
+	Document string `dynamodbutils:"encrypt"`
+}
+
+func TestEncryptAndDecryptAttributes(t *testing.T) {
+	provider, err := NewLocalKeyProvider([]byte("0123456789abcdef0123456789abcdef"))
+	check(err)
+
+	SetEncryption(provider)
+	defer SetEncryption(nil)
+
+	customer := Customer{State: "SP", Id: 1, Name: "Maria", Document: "123.456.789-00"}
+
+	item, _, err := marshalItem(tablename, customer)
+	check(err)
+
+	if item["Document"].B == nil {
+		t.Errorf("Document should have been encrypted but was %v", item["Document"])
+	}
+	if *item["Name"].S != "Maria" {
+		t.Errorf("Name should not have been encrypted but was %v", item["Name"])
+	}
+
+	found := Customer{}
+	check(unmarshalItem(tablename, item, &found, false))
+
+	if !reflect.DeepEqual(found, customer) {
+		t.Errorf("Expected: %+v, Result: %+v", customer, found)
+	}
+
+	// changing a signed attribute must be detected
+	item["Name"] = &dynamodb.AttributeValue{S: aws.String("Joana")}
+	if err = unmarshalItem(tablename, item, &found, false); err == nil {
+		t.Error("the tampered item should have been rejected")
+	}
+
+	// as well as reading the item as if it were from another table
+	item["Name"] = &dynamodb.AttributeValue{S: aws.String("Maria")}
+	if err = unmarshalItem("another-table", item, &found, false); err == nil {
+		t.Error("the item should have been rejected on another table")
+	}
+}
+
+func TestPutItemAndGetItemWithEncryption(t *testing.T) {
+	provider, err := NewLocalKeyProvider([]byte("0123456789abcdef0123456789abcdef"))
+	check(err)
+
+	SetEncryption(provider)
+	defer SetEncryption(nil)
+
+	customer := Customer{State: "ENC", Id: 1, Name: "Maria", Document: "123.456.789-00"}
+	check(PutItem(tablename, customer))
+
+	found := Customer{}
+	check(GetItem(tablename, Key{PKName: "State", PKValue: "ENC", SKName: "Id", SKValue: 1}, &found))
+
+	if !reflect.DeepEqual(found, customer) {
+		t.Errorf("Expected: %+v, Result: %+v", customer, found)
+	}
+
+	customers := []Customer{}
+	check(Query(tablename, KeyCondition{PKName: "State", PKValue: "ENC"}, &customers))
+
+	if len(customers) != 1 || !reflect.DeepEqual(customers[0], customer) {
+		t.Errorf("Expected: [%+v], Result: %+v", customer, customers)
+	}
+}
+
+func TestDecryptAttributesRejectsInjectedAttributes(t *testing.T) {
+	provider, err := NewLocalKeyProvider([]byte("0123456789abcdef0123456789abcdef"))
+	check(err)
+
+	SetEncryption(provider)
+	defer SetEncryption(nil)
+
+	item, _, err := marshalItem(tablename, Customer{State: "SP", Id: 1, Name: "Maria", Document: "123.456.789-00"})
+	check(err)
+
+	// an attribute added to the item and declared as unsigned on the metadata must be detected
+	item["Role"] = &dynamodb.AttributeValue{S: aws.String("admin")}
+	item[encryptionAttributeName].M["unsigned"] = &dynamodb.AttributeValue{SS: aws.StringSlice([]string{"Role"})}
+
+	found := map[string]interface{}{}
+	if err = unmarshalItem(tablename, item, &found, false); err == nil {
+		t.Errorf("the injected attribute should have been rejected, but the item was read as %v", found)
+	}
+}
+
+func TestEncryptAttributesRejectsKeys(t *testing.T) {
+	provider, err := NewLocalKeyProvider([]byte("0123456789abcdef0123456789abcdef"))
+	check(err)
+
+	SetEncryption(provider)
+	defer SetEncryption(nil)
+
+	type EncryptedKey struct {
+		State string `dynamodbutils:"encrypt"`
+		Id    int
+	}
+
+	if _, _, err = marshalItem(tablename, EncryptedKey{State: "SP", Id: 1}); err == nil {
+		t.Error("encrypting the partition key of the table should have failed")
+	}
+}
+
+func TestUpdateItemRejectsSignedItems(t *testing.T) {
+	provider, err := NewLocalKeyProvider([]byte("0123456789abcdef0123456789abcdef"))
+	check(err)
+
+	SetEncryption(provider)
+	defer SetEncryption(nil)
+
+	customer := Customer{State: "ENC", Id: 2, Name: "Maria", Document: "123.456.789-00"}
+	check(PutItem(tablename, customer))
+
+	key := Key{PKName: "State", PKValue: "ENC", SKName: "Id", SKValue: 2}
+	if err = UpdateItem(tablename, key, map[string]interface{}{"Name": "Joana"}); err == nil {
+		t.Error("changing a signed attribute with UpdateItem should have failed")
+	}
+
+	// the item was not changed, so it can still be read
+	found := Customer{}
+	check(GetItem(tablename, key, &found))
+	if !reflect.DeepEqual(found, customer) {
+		t.Errorf("Expected: %+v, Result: %+v", customer, found)
+	}
+}
+
+type countingKeyProvider struct {
+	KeyProvider
+	decrypted int
+}
+
+func (p *countingKeyProvider) DecryptDataKey(encryptedKey []byte) ([]byte, error) {
+	p.decrypted++
+	return p.KeyProvider.DecryptDataKey(encryptedKey)
+}
+
+func TestDecryptedDataKeysAreCached(t *testing.T) {
+	local, err := NewLocalKeyProvider([]byte("0123456789abcdef0123456789abcdef"))
+	check(err)
+	provider := &countingKeyProvider{KeyProvider: local}
+
+	SetEncryption(provider)
+	defer SetEncryption(nil)
+
+	item, _, err := marshalItem(tablename, Customer{State: "SP", Id: 1, Name: "Maria", Document: "123.456.789-00"})
+	check(err)
+
+	for i := 0; i < 3; i++ {
+		found := Customer{}
+		check(unmarshalItem(tablename, item, &found, false))
+	}
+
+	if provider.decrypted != 1 {
+		t.Errorf("the data key should have been decrypted once but was decrypted %d times", provider.decrypted)
+	}
+}
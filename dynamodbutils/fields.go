@@ -0,0 +1,130 @@
+package dynamodbutils
+
+import (
+	"reflect"
+	"strings"
+)
+
+// structField describes a struct field mapped to an item attribute.
+//   - Name: the name of the attribute, taken from the 'dynamodbav' tag, the 'json' tag or the field name.
+//   - Index: the index sequence of the field, to be used with reflect.Value.FieldByIndex.
+//   - Options: the options given in the field's 'dynamodbutils' tag, e.g. `dynamodbutils:"s3"`.
+//   - TagOptions: the options given in the tag the name was taken from, e.g. "omitempty" or "unixtime".
+type structField struct {
+	Name       string
+	Index      []int
+	Type       reflect.Type
+	Options    []string
+	TagOptions []string
+}
+
+// hasOption tells whether the field's 'dynamodbutils' tag holds the given option.
+func (f structField) hasOption(option string) bool {
+	for _, o := range f.Options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// structFields returns the fields of a struct type that dynamodbattribute maps to item attributes, according
+// to the options set with SetMarshalingOptions.
+// Pointers, slices and maps are followed to their element type; types that are not structs have no fields.
+func structFields(t reflect.Type) []structField {
+	return structFieldsWith(t, marshalingOptions)
+}
+
+// structFieldsWith works like structFields with the given marshaling options.
+func structFieldsWith(t reflect.Type, opts MarshalingOptions) []structField {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := []structField{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		// as in dynamodbattribute, the json tag is used when the field has no dynamodbav tag
+		tag := field.Tag.Get("dynamodbav")
+		if len(tag) == 0 && !opts.IgnoreJSONTags {
+			tag = field.Tag.Get("json")
+		}
+
+		name, tagOptions := parseFieldTag(tag)
+		if name == "-" {
+			continue
+		}
+
+		// the fields of embedded structs are promoted to the parent item, as dynamodbattribute does
+		if field.Anonymous && len(name) == 0 {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				for _, embedded := range structFieldsWith(fieldType, opts) {
+					embedded.Index = append([]int{i}, embedded.Index...)
+					fields = append(fields, embedded)
+				}
+				continue
+			}
+		}
+
+		if len(field.PkgPath) > 0 {
+			// unexported field
+			continue
+		}
+
+		if len(name) == 0 {
+			name = field.Name
+		}
+
+		options := []string{}
+		if tag, ok := field.Tag.Lookup("dynamodbutils"); ok {
+			options = strings.Split(tag, ",")
+		}
+
+		fields = append(fields, structField{
+			Name:       name,
+			Index:      field.Index,
+			Type:       field.Type,
+			Options:    options,
+			TagOptions: tagOptions,
+		})
+	}
+
+	return fields
+}
+
+// structAttributeNames returns the names of the attributes mapped to the fields of a struct type.
+func structAttributeNames(t reflect.Type) []string {
+	names := []string{}
+	for _, field := range structFields(t) {
+		names = append(names, field.Name)
+	}
+	return names
+}
+
+// taggedAttributeNames returns the names of the attributes whose fields have the given option
+// on their 'dynamodbutils' tag.
+func taggedAttributeNames(t reflect.Type, option string) []string {
+	names := []string{}
+	for _, field := range structFields(t) {
+		if field.hasOption(option) {
+			names = append(names, field.Name)
+		}
+	}
+	return names
+}
+
+// parseFieldTag splits a struct tag value like "name,opt1,opt2" into its name and options.
+func parseFieldTag(tag string) (name string, options []string) {
+	parts := strings.Split(tag, ",")
+	return parts[0], parts[1:]
+}
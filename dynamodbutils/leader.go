@@ -0,0 +1,294 @@
+package dynamodbutils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// The attributes of the item holding the leadership.
+const (
+	LeaderOwnerAttributeName     = "LeaderOwner"
+	LeaderExpiresAtAttributeName = "LeaderExpiresAt"
+)
+
+// LeaderElectionOptions holds the settings of a LeaderElection.
+//   - TableName: the table where the leadership is stored.
+//   - Key: the key of the item holding the leadership, e.g. Key{PKName: "Id", PKValue: "billing-cron"}.
+//     The candidates of the same election must use the same key.
+//   - OwnerId: identifies the candidate. Default: the host name followed by a random suffix.
+//   - LeaseDuration: for how long the leadership is held without a heartbeat. When the leader stops
+//     without releasing it, another candidate is elected after this time. Default 15s.
+//   - HeartbeatInterval: the interval between the renewals of the leadership by the leader and the
+//     attempts to acquire it by the other candidates. Default LeaseDuration/3.
+//   - OnElected: called in a new goroutine when the candidate is elected. Its context is cancelled when
+//     the leadership is lost or the election stops, and the work done as leader must stop with it.
+//   - OnDemoted: called when the leadership is lost or released, after the context of OnElected is cancelled.
+//
+// The expiration of the leadership is stored as a timestamp, so the clocks of the candidates must be
+// synchronized with a precision much smaller than LeaseDuration. The leader steps down a safety margin of
+// LeaseDuration/5 before its lease expires if it could not renew it, whether the renewal failed or is still
+// running, so it stops working as leader before another candidate can be elected.
+type LeaderElectionOptions struct {
+	TableName         string                    // mandatory
+	Key               Key                       // mandatory
+	OwnerId           string                    // optional
+	LeaseDuration     time.Duration             // optional
+	HeartbeatInterval time.Duration             // optional
+	OnElected         func(ctx context.Context) // optional
+	OnDemoted         func()                    // optional
+}
+
+// LeaderElection elects one leader among many candidates, e.g. the pods running the same scheduled worker,
+// using conditional writes on an item of a dynamodb table: the leader renews its lease on the item with
+// heartbeats, and the other candidates take the leadership when the lease expires.
+//
+// Example:
+//
+//	election := NewLeaderElection(LeaderElectionOptions{
+//	    TableName: "Locks",
+//	    Key:       Key{PKName: "Id", PKValue: "billing-cron"},
+//	    OnElected: func(ctx context.Context) {
+//	        runScheduler(ctx) // must return when ctx is cancelled
+//	    },
+//	})
+//
+// err := election.Run(ctx)
+type LeaderElection struct {
+	opts LeaderElectionOptions
+
+	mutex         sync.Mutex
+	leader        bool
+	leaseEnd      time.Time
+	cancelElected context.CancelFunc
+	demoteTimer   *time.Timer
+}
+
+// NewLeaderElection creates a LeaderElection with the given options. The candidate only takes part in the
+// election while Run is running.
+func NewLeaderElection(opts LeaderElectionOptions) *LeaderElection {
+	if len(opts.OwnerId) == 0 {
+		hostname, _ := os.Hostname()
+		opts.OwnerId = hostname + "-" + randomObjectKey()[:8]
+	}
+	if opts.LeaseDuration <= 0 {
+		opts.LeaseDuration = 15 * time.Second
+	}
+	if opts.HeartbeatInterval <= 0 {
+		opts.HeartbeatInterval = opts.LeaseDuration / 3
+	}
+
+	return &LeaderElection{opts: opts}
+}
+
+// OwnerId returns the identifier of the candidate.
+func (e *LeaderElection) OwnerId() string {
+	return e.opts.OwnerId
+}
+
+// IsLeader tells whether the candidate is the leader.
+func (e *LeaderElection) IsLeader() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.leader
+}
+
+// Run takes part in the election until the context is done, then releases the leadership if it holds it,
+// so another candidate can be elected right away, and returns the error of the context.
+//
+// The errors of dynamodb do not stop the election: the leader is demoted if it cannot renew its lease
+// before it expires, and the other candidates keep trying to acquire it.
+func (e *LeaderElection) Run(ctx context.Context) error {
+	if len(e.opts.TableName) == 0 || len(e.opts.Key.PKName) == 0 {
+		return errors.New("dynamodbutils.LeaderElection: TableName and Key are mandatory")
+	}
+
+	ticker := time.NewTicker(e.opts.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		e.heartbeat(ctx)
+
+		select {
+		case <-ctx.Done():
+			if e.IsLeader() {
+				e.demote()
+				e.release()
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// safetyMargin is how long before the end of its lease the leader steps down if it was not renewed.
+func (e *LeaderElection) safetyMargin() time.Duration {
+	return e.opts.LeaseDuration / 5
+}
+
+// heartbeat renews the lease of the leader or tries to acquire it.
+func (e *LeaderElection) heartbeat(ctx context.Context) {
+	// the renewal must not outlast the lease, which would keep the leader working while it expires
+	timeout := e.opts.LeaseDuration - e.safetyMargin()
+	if e.opts.HeartbeatInterval < timeout {
+		timeout = e.opts.HeartbeatInterval
+	}
+
+	acquireCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	now := time.Now()
+
+	err := e.acquire(acquireCtx, now)
+
+	switch {
+	case err == nil:
+		// the context of the leader is created with the demotion scheduled, so a demotion always cancels it
+		var electedCtx context.Context
+
+		e.mutex.Lock()
+		if !e.leader {
+			electedCtx, e.cancelElected = context.WithCancel(ctx)
+		}
+		e.leader = true
+		e.leaseEnd = now.Add(e.opts.LeaseDuration)
+		e.scheduleDemotion()
+		e.mutex.Unlock()
+
+		if electedCtx != nil {
+			e.elect(electedCtx)
+		}
+
+	case isConditionalCheckFailed(err):
+		// another candidate holds the lease
+		if e.IsLeader() {
+			e.demote()
+		}
+
+	default:
+		// the lease could not be renewed: the leader steps down before it expires, see scheduleDemotion
+	}
+}
+
+// scheduleDemotion sets the timer that demotes the leader a safety margin before the end of its lease,
+// unless the lease is renewed before. It must be called with the mutex locked.
+func (e *LeaderElection) scheduleDemotion() {
+	if e.demoteTimer != nil {
+		e.demoteTimer.Stop()
+	}
+
+	leaseEnd := e.leaseEnd
+
+	e.demoteTimer = time.AfterFunc(time.Until(leaseEnd.Add(-e.safetyMargin())), func() {
+		e.mutex.Lock()
+		expiring := e.leader && e.leaseEnd.Equal(leaseEnd)
+		e.mutex.Unlock()
+
+		if expiring {
+			e.demote()
+		}
+	})
+}
+
+// acquire writes the lease of the candidate if it is free, expired or already held by the candidate.
+// The item is written with the dynamodb client itself, so none of the transformations of PutItem
+// (audit attributes, encryption, offloading or validation) are applied to it.
+func (e *LeaderElection) acquire(ctx context.Context, now time.Time) error {
+	item, err := marshalKey(e.opts.Key)
+	if err != nil {
+		return err
+	}
+
+	item[LeaderOwnerAttributeName] = &dynamodb.AttributeValue{S: aws.String(e.opts.OwnerId)}
+	item[LeaderExpiresAtAttributeName] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(unixMilliseconds(now.Add(e.opts.LeaseDuration)), 10))}
+
+	condition, err := Or(
+		AttributeNotExists(LeaderOwnerAttributeName),
+		Eq(LeaderOwnerAttributeName, e.opts.OwnerId),
+		Lt(LeaderExpiresAtAttributeName, unixMilliseconds(now)),
+	).encode()
+	if err != nil {
+		return err
+	}
+
+	_, err = newClient().PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(e.opts.TableName),
+		Item:                      item,
+		ConditionExpression:       condition.Expression,
+		ExpressionAttributeNames:  condition.Names,
+		ExpressionAttributeValues: condition.Values,
+	})
+
+	return err
+}
+
+// release deletes the lease if it is still held by the candidate.
+func (e *LeaderElection) release() {
+	keyAttributes, err := marshalKey(e.opts.Key)
+	if err != nil {
+		return
+	}
+
+	condition, err := Eq(LeaderOwnerAttributeName, e.opts.OwnerId).encode()
+	if err != nil {
+		return
+	}
+
+	newClient().DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:                 aws.String(e.opts.TableName),
+		Key:                       keyAttributes,
+		ConditionExpression:       condition.Expression,
+		ExpressionAttributeNames:  condition.Names,
+		ExpressionAttributeValues: condition.Values,
+	})
+}
+
+func unixMilliseconds(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// elect starts the work of the leader with the context created when it was elected, which may already be
+// cancelled if it was demoted meanwhile.
+func (e *LeaderElection) elect(electedCtx context.Context) {
+	if e.opts.OnElected != nil {
+		go e.opts.OnElected(electedCtx)
+	}
+}
+
+func (e *LeaderElection) demote() {
+	e.mutex.Lock()
+	if !e.leader {
+		// already demoted, e.g. by the timer
+		e.mutex.Unlock()
+		return
+	}
+	cancel := e.cancelElected
+	e.leader = false
+	e.cancelElected = nil
+	if e.demoteTimer != nil {
+		e.demoteTimer.Stop()
+		e.demoteTimer = nil
+	}
+	e.mutex.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+
+	if e.opts.OnDemoted != nil {
+		e.opts.OnDemoted()
+	}
+}
+
+func isConditionalCheckFailed(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
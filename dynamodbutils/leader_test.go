@@ -0,0 +1,97 @@
+package dynamodbutils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLeaderElection(t *testing.T) {
+	key := Key{PKName: "State", PKValue: "LEADER", SKName: "Id", SKValue: 1}
+
+	elected := make(chan string, 2)
+	lost := make(chan string, 2)
+
+	newCandidate := func(ownerId string) *LeaderElection {
+		return NewLeaderElection(LeaderElectionOptions{
+			TableName:         tablename,
+			Key:               key,
+			OwnerId:           ownerId,
+			LeaseDuration:     2 * time.Second,
+			HeartbeatInterval: 200 * time.Millisecond,
+			OnElected: func(ctx context.Context) {
+				elected <- ownerId
+				<-ctx.Done()
+				lost <- ownerId
+			},
+		})
+	}
+
+	first, second := newCandidate("first"), newCandidate("second")
+
+	firstCtx, stopFirst := context.WithCancel(context.Background())
+	go first.Run(firstCtx)
+
+	if leader := <-elected; leader != "first" {
+		t.Fatalf("the first candidate should have been elected but %s was", leader)
+	}
+
+	secondCtx, stopSecond := context.WithCancel(context.Background())
+	defer stopSecond()
+	go second.Run(secondCtx)
+
+	time.Sleep(time.Second)
+	if second.IsLeader() || !first.IsLeader() {
+		t.Errorf("the first candidate should still be the only leader")
+	}
+
+	// the first candidate releases the leadership when it stops
+	stopFirst()
+
+	select {
+	case leader := <-elected:
+		if leader != "second" {
+			t.Errorf("the second candidate should have been elected but %s was", leader)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("the second candidate was not elected")
+	}
+
+	select {
+	case owner := <-lost:
+		if owner != "first" {
+			t.Errorf("the context of the first leader should have been cancelled but %s's was", owner)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("the context of the first leader was not cancelled")
+	}
+}
+
+func TestLeaderDemotedBeforeLeaseExpires(t *testing.T) {
+	lost := make(chan time.Time, 1)
+
+	election := NewLeaderElection(LeaderElectionOptions{
+		TableName:     tablename,
+		Key:           Key{PKName: "State", PKValue: "LEADER", SKName: "Id", SKValue: 2},
+		LeaseDuration: time.Second,
+		OnDemoted:     func() { lost <- time.Now() },
+	})
+
+	// a single renewal: the leader must step down on its own before the lease expires
+	start := time.Now()
+	election.heartbeat(context.Background())
+	if !election.IsLeader() {
+		t.Fatalf("the candidate should have been elected")
+	}
+
+	select {
+	case demotedAt := <-lost:
+		if elapsed := demotedAt.Sub(start); elapsed >= time.Second {
+			t.Errorf("the leader should have been demoted before the lease expired but was after %v", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("the leader was not demoted")
+	}
+
+	election.release()
+}
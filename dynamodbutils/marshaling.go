@@ -0,0 +1,444 @@
+package dynamodbutils
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// TimeFormat is the format in which the time.Time values are stored.
+type TimeFormat int
+
+const (
+	// TimeRFC3339 stores the times as strings in the RFC3339 format, e.g. "2021-10-19T13:45:00.123Z". It is the default.
+	TimeRFC3339 TimeFormat = iota
+	// TimeUnixSeconds stores the times as numbers holding the seconds since the unix epoch.
+	TimeUnixSeconds
+	// TimeUnixMilliseconds stores the times as numbers holding the milliseconds since the unix epoch.
+	TimeUnixMilliseconds
+)
+
+// MarshalingOptions holds the settings used to convert the items between Go values and the dynamodb format.
+// The zero value gives the default behavior of the aws sdk (dynamodbattribute).
+//   - IgnoreJSONTags: when true the 'json' tags of the fields are ignored. By default a field without a
+//     'dynamodbav' tag takes the name and options of its 'json' tag, e.g. `json:"name,omitempty"`.
+//   - TimeFormat: how the time.Time values are stored. The fields tagged with `dynamodbav:",unixtime"` are
+//     always stored as seconds. Times stored in any of the formats can be read back: the numbers are read as
+//     milliseconds when their absolute value is at least 100000000000 (March 1973 in milliseconds, year 5138
+//     in seconds), and as seconds otherwise.
+//   - OmitEmpty: when true the fields holding zero values are not stored, as if all of them were tagged with
+//     'omitempty'.
+//   - SlicesAsSets: when true the slices of strings, numbers and []byte are stored as sets (SS, NS and BS)
+//     instead of lists. Duplicated elements are removed and their order is not kept.
+//   - Strict: when true reading an item into a struct fails if the item has an attribute that is not
+//     mapped to any of the struct's fields, instead of silently ignoring it. As in dynamodbattribute, the
+//     attributes are mapped to the fields ignoring the case, on the item and on its nested structs.
+type MarshalingOptions struct {
+	IgnoreJSONTags bool       // optional
+	TimeFormat     TimeFormat // optional
+	OmitEmpty      bool       // optional
+	SlicesAsSets   bool       // optional
+	Strict         bool       // optional
+}
+
+var marshalingOptions MarshalingOptions
+
+// SetMarshalingOptions sets the options used by all the functions of the package to convert the items,
+// keys and values between Go and dynamodb.
+//
+// Example:
+//
+// SetMarshalingOptions(MarshalingOptions{TimeFormat: TimeUnixMilliseconds, OmitEmpty: true, Strict: true})
+func SetMarshalingOptions(opts MarshalingOptions) {
+	marshalingOptions = opts
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var marshalerType = reflect.TypeOf((*dynamodbattribute.Marshaler)(nil)).Elem()
+var unmarshalerType = reflect.TypeOf((*dynamodbattribute.Unmarshaler)(nil)).Elem()
+
+func (o MarshalingOptions) encoder() *dynamodbattribute.Encoder {
+	return dynamodbattribute.NewEncoder(func(e *dynamodbattribute.Encoder) {
+		e.SupportJSONTags = !o.IgnoreJSONTags
+	})
+}
+
+func (o MarshalingOptions) decoder() *dynamodbattribute.Decoder {
+	return dynamodbattribute.NewDecoder(func(d *dynamodbattribute.Decoder) {
+		d.SupportJSONTags = !o.IgnoreJSONTags
+	})
+}
+
+// marshalValue converts a value into the dynamodb format according to the marshaling options.
+func marshalValue(value interface{}) (*dynamodb.AttributeValue, error) {
+	opts := marshalingOptions
+
+	attribute, err := opts.encoder().Encode(value)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.adjustEncoded(reflect.ValueOf(value), attribute)
+
+	return attribute, nil
+}
+
+// marshalMap converts a struct or a map into an item in the dynamodb format according to the marshaling options.
+func marshalMap(value interface{}) (map[string]*dynamodb.AttributeValue, error) {
+	attribute, err := marshalValue(value)
+	if err != nil || attribute == nil || attribute.M == nil {
+		return map[string]*dynamodb.AttributeValue{}, err
+	}
+	return attribute.M, nil
+}
+
+// unmarshalMap fills the struct or map pointed by 'out' with an item according to the marshaling options.
+// The given item is not modified.
+func unmarshalMap(item map[string]*dynamodb.AttributeValue, out interface{}) error {
+	return unmarshalValue(&dynamodb.AttributeValue{M: item}, out)
+}
+
+// unmarshalListOfMaps fills the slice pointed by 'out' with a list of items according to the marshaling options.
+func unmarshalListOfMaps(items []map[string]*dynamodb.AttributeValue, out interface{}) error {
+	list := make([]*dynamodb.AttributeValue, 0, len(items))
+	for _, item := range items {
+		list = append(list, &dynamodb.AttributeValue{M: item})
+	}
+	return unmarshalValue(&dynamodb.AttributeValue{L: list}, out)
+}
+
+func unmarshalValue(attribute *dynamodb.AttributeValue, out interface{}) error {
+	opts := marshalingOptions
+
+	attribute, err := opts.adjustDecoded(reflect.TypeOf(out), attribute, "")
+	if err != nil {
+		return err
+	}
+
+	return opts.decoder().Decode(attribute, out)
+}
+
+// adjustEncoded applies the options not supported by dynamodbattribute to the attribute encoded from 'v'.
+func (o MarshalingOptions) adjustEncoded(v reflect.Value, attribute *dynamodb.AttributeValue) {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	if !v.IsValid() || attribute == nil || implementsMarshaler(v.Type(), marshalerType) {
+		return
+	}
+
+	if v.Type().ConvertibleTo(timeType) {
+		if attribute.S != nil && o.TimeFormat != TimeRFC3339 {
+			*attribute = *o.encodeTime(v.Convert(timeType).Interface().(time.Time))
+		}
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if attribute.M == nil {
+			return
+		}
+		for _, field := range structFieldsWith(v.Type(), o) {
+			fieldValue, ok := fieldByIndex(v, field.Index)
+			fieldAttribute, exists := attribute.M[field.Name]
+			if !ok || !exists {
+				continue
+			}
+			if o.OmitEmpty && fieldValue.IsZero() {
+				delete(attribute.M, field.Name)
+				continue
+			}
+			if hasString(field.TagOptions, "unixtime") {
+				continue
+			}
+			o.adjustEncoded(fieldValue, fieldAttribute)
+		}
+
+	case reflect.Map:
+		if attribute.M == nil || v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		for _, key := range v.MapKeys() {
+			o.adjustEncoded(v.MapIndex(key), attribute.M[key.String()])
+		}
+
+	case reflect.Slice, reflect.Array:
+		if attribute.L == nil {
+			return
+		}
+		for i := 0; i < v.Len() && i < len(attribute.L); i++ {
+			o.adjustEncoded(v.Index(i), attribute.L[i])
+		}
+		if o.SlicesAsSets {
+			toSet(v.Type().Elem(), attribute)
+		}
+	}
+}
+
+// adjustDecoded undoes the changes made by adjustEncoded on an attribute to be decoded into a value of type 't',
+// and checks for unmapped attributes in strict mode. The attribute is copied when changed, since it may be shared
+// with the cache.
+func (o MarshalingOptions) adjustDecoded(t reflect.Type, attribute *dynamodb.AttributeValue, path string) (*dynamodb.AttributeValue, error) {
+	if t == nil || attribute == nil {
+		return attribute, nil
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if implementsMarshaler(t, unmarshalerType) {
+		return attribute, nil
+	}
+
+	if t.ConvertibleTo(timeType) {
+		if attribute.N != nil {
+			return decodeTime(attribute.N)
+		}
+		return attribute, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if attribute.M == nil {
+			return attribute, nil
+		}
+
+		fields := structFieldsWith(t, o)
+		adjusted := attribute
+
+		for _, field := range fields {
+			name, ok := fieldAttributeName(attribute.M, field.Name)
+			if !ok || hasString(field.TagOptions, "unixtime") {
+				continue
+			}
+			fieldAttribute := attribute.M[name]
+
+			decoded, err := o.adjustDecoded(field.Type, fieldAttribute, joinPath(path, name))
+			if err != nil {
+				return nil, err
+			}
+
+			if decoded != fieldAttribute {
+				if adjusted == attribute {
+					adjusted = &dynamodb.AttributeValue{M: copyAttributes(attribute.M)}
+				}
+				adjusted.M[name] = decoded
+			}
+		}
+
+		if o.Strict {
+			for name := range attribute.M {
+				if !isMappedAttribute(fields, name) {
+					return nil, fmt.Errorf("dynamodbutils: the attribute '%s' is not mapped to any field of %s", joinPath(path, name), t)
+				}
+			}
+		}
+
+		return adjusted, nil
+
+	case reflect.Map:
+		if attribute.M == nil {
+			return attribute, nil
+		}
+
+		adjusted := attribute
+
+		for name, elementAttribute := range attribute.M {
+			decoded, err := o.adjustDecoded(t.Elem(), elementAttribute, joinPath(path, name))
+			if err != nil {
+				return nil, err
+			}
+			if decoded != elementAttribute {
+				if adjusted == attribute {
+					adjusted = &dynamodb.AttributeValue{M: copyAttributes(attribute.M)}
+				}
+				adjusted.M[name] = decoded
+			}
+		}
+
+		return adjusted, nil
+
+	case reflect.Slice, reflect.Array:
+		if attribute.L == nil {
+			return attribute, nil
+		}
+
+		adjusted := attribute
+
+		for i, elementAttribute := range attribute.L {
+			decoded, err := o.adjustDecoded(t.Elem(), elementAttribute, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			if decoded != elementAttribute {
+				if adjusted == attribute {
+					adjusted = &dynamodb.AttributeValue{L: append([]*dynamodb.AttributeValue{}, attribute.L...)}
+				}
+				adjusted.L[i] = decoded
+			}
+		}
+
+		return adjusted, nil
+	}
+
+	return attribute, nil
+}
+
+func (o MarshalingOptions) encodeTime(t time.Time) *dynamodb.AttributeValue {
+	switch o.TimeFormat {
+	case TimeUnixSeconds:
+		return &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(t.Unix(), 10))}
+	case TimeUnixMilliseconds:
+		return &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10))}
+	default:
+		return &dynamodb.AttributeValue{S: aws.String(t.UTC().Format(time.RFC3339Nano))}
+	}
+}
+
+// minUnixMilliseconds is the smallest absolute value of a unix time read as milliseconds by decodeTime.
+const minUnixMilliseconds = 100000000000
+
+// decodeTime converts a unix time, in seconds or in milliseconds, into the format read by dynamodbattribute.
+func decodeTime(n *string) (*dynamodb.AttributeValue, error) {
+	value, err := strconv.ParseInt(*n, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("dynamodbutils: the number %s is not a valid unix time: %s", *n, err.Error())
+	}
+
+	var t time.Time
+	if value >= minUnixMilliseconds || value <= -minUnixMilliseconds {
+		t = time.Unix(0, value*int64(time.Millisecond))
+	} else {
+		t = time.Unix(value, 0)
+	}
+
+	return &dynamodb.AttributeValue{S: aws.String(t.UTC().Format(time.RFC3339Nano))}, nil
+}
+
+// toSet converts a list of strings, numbers or binaries into a set, removing the duplicated elements.
+func toSet(elementType reflect.Type, attribute *dynamodb.AttributeValue) {
+	if len(attribute.L) == 0 {
+		return
+	}
+
+	kind := elementType.Kind()
+	isBinary := kind == reflect.Slice && elementType.Elem().Kind() == reflect.Uint8
+	isNumber := kind >= reflect.Int && kind <= reflect.Float64
+	isString := kind == reflect.String
+
+	if !isBinary && !isNumber && !isString {
+		return
+	}
+
+	seen := make(map[string]bool)
+	set := &dynamodb.AttributeValue{}
+
+	for _, element := range attribute.L {
+		switch {
+		case isString && element.S != nil:
+			if !seen[*element.S] {
+				set.SS = append(set.SS, element.S)
+			}
+			seen[*element.S] = true
+		case isNumber && element.N != nil:
+			if !seen[*element.N] {
+				set.NS = append(set.NS, element.N)
+			}
+			seen[*element.N] = true
+		case isBinary && element.B != nil:
+			if !seen[string(element.B)] {
+				set.BS = append(set.BS, element.B)
+			}
+			seen[string(element.B)] = true
+		default:
+			// e.g. a NULL element: the list cannot be stored as a set
+			return
+		}
+	}
+
+	*attribute = *set
+}
+
+// implementsMarshaler tells whether the type or a pointer to it implements the given interface, in which case
+// the attribute is converted by the type itself.
+func implementsMarshaler(t reflect.Type, marshaler reflect.Type) bool {
+	return t.Implements(marshaler) || reflect.PtrTo(t).Implements(marshaler)
+}
+
+// fieldByIndex works like reflect.Value.FieldByIndex but returns false if an embedded struct pointer is nil.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// fieldAttributeName finds the attribute of the item mapped to a field: the one with the field's name or,
+// like dynamodbattribute, one whose name only differs in case.
+func fieldAttributeName(item map[string]*dynamodb.AttributeValue, fieldName string) (string, bool) {
+	if _, ok := item[fieldName]; ok {
+		return fieldName, true
+	}
+	for name := range item {
+		if strings.EqualFold(name, fieldName) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// isMappedAttribute tells whether an attribute is mapped to one of the fields. Like dynamodbattribute, the
+// names are also matched ignoring the case. The attributes used internally by the package are always mapped.
+func isMappedAttribute(fields []structField, name string) bool {
+	if strings.HasPrefix(name, "dynamodbutils:") {
+		return true
+	}
+	for _, field := range fields {
+		if field.Name == name || strings.EqualFold(field.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func copyAttributes(item map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	copied := make(map[string]*dynamodb.AttributeValue, len(item))
+	for name, attribute := range item {
+		copied[name] = attribute
+	}
+	return copied
+}
+
+func joinPath(path string, name string) string {
+	if len(path) == 0 {
+		return name
+	}
+	return path + "." + name
+}
+
+func hasString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
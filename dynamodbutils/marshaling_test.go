@@ -0,0 +1,132 @@
+package dynamodbutils
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type Event struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Tags      []string  `json:"tags"`
+	Scores    []int     `json:"scores"`
+	At        time.Time `json:"at"`
+	ExpiresAt time.Time `json:"expiresAt" dynamodbav:"expiresAt,unixtime"`
+	Details   *EventDetails
+}
+
+type EventDetails struct {
+	Count int
+	When  time.Time
+}
+
+func TestMarshalingOptions(t *testing.T) {
+	defer SetMarshalingOptions(MarshalingOptions{})
+
+	at := time.Date(2021, 10, 19, 13, 45, 0, 123000000, time.UTC)
+	event := Event{Id: "1", Tags: []string{"a", "b", "a"}, Scores: []int{1, 2}, At: at, ExpiresAt: at, Details: &EventDetails{When: at}}
+
+	SetMarshalingOptions(MarshalingOptions{TimeFormat: TimeUnixMilliseconds, OmitEmpty: true, SlicesAsSets: true})
+
+	item, err := marshalMap(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := item["name"]; ok {
+		t.Errorf("the empty name should have been omitted")
+	}
+	if aws.StringValue(item["at"].N) != "1634651100123" {
+		t.Errorf("the time should have been stored as milliseconds but was %v", item["at"])
+	}
+	if aws.StringValue(item["expiresAt"].N) != "1634651100" {
+		t.Errorf("the unixtime field should have been stored as seconds but was %v", item["expiresAt"])
+	}
+	if len(item["tags"].SS) != 2 || len(item["scores"].NS) != 2 {
+		t.Errorf("the slices should have been stored as sets but were %v and %v", item["tags"], item["scores"])
+	}
+	if details := item["Details"].M; details == nil || details["Count"] != nil || aws.StringValue(details["When"].N) != "1634651100123" {
+		t.Errorf("the options should have been applied to the nested struct but it was %v", item["Details"])
+	}
+
+	read := Event{}
+	if err := unmarshalMap(item, &read); err != nil {
+		t.Fatal(err)
+	}
+	if !read.At.Equal(at) || !read.ExpiresAt.Equal(at.Truncate(time.Second)) || !read.Details.When.Equal(at) {
+		t.Errorf("the times were not read back: %+v", read)
+	}
+	if aws.StringValue(item["at"].N) != "1634651100123" {
+		t.Errorf("unmarshaling must not modify the item")
+	}
+
+	// the times stored as strings are still read
+	events := []Event{}
+	if err := unmarshalListOfMaps([]map[string]*dynamodb.AttributeValue{{"at": {S: aws.String("2021-10-19T13:45:00.123Z")}}}, &events); err != nil || !events[0].At.Equal(at) {
+		t.Errorf("the RFC3339 time was not read: %v %+v", err, events)
+	}
+
+	SetMarshalingOptions(MarshalingOptions{Strict: true})
+
+	if err := unmarshalMap(map[string]*dynamodb.AttributeValue{"id": {S: aws.String("1")}, "Other": {S: aws.String("x")}}, &read); err == nil {
+		t.Errorf("the unmapped attribute should have been rejected in strict mode")
+	}
+	if err := unmarshalMap(map[string]*dynamodb.AttributeValue{"ID": {S: aws.String("1")}}, &read); err != nil {
+		t.Errorf("the attributes are matched ignoring the case, as dynamodbattribute does: %s", err)
+	}
+
+	SetMarshalingOptions(MarshalingOptions{IgnoreJSONTags: true})
+
+	names := structAttributeNames(reflect.TypeOf(Event{}))
+	expected := []string{"Id", "Name", "Tags", "Scores", "At", "expiresAt", "Details"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("the attribute names should be %v but were %v", expected, names)
+	}
+}
+
+func TestReadTimesInAnyFormat(t *testing.T) {
+	defer SetMarshalingOptions(MarshalingOptions{})
+
+	at := time.Date(2021, 10, 19, 13, 45, 0, 123000000, time.UTC)
+
+	for _, format := range []TimeFormat{TimeRFC3339, TimeUnixSeconds, TimeUnixMilliseconds} {
+		SetMarshalingOptions(MarshalingOptions{TimeFormat: format})
+
+		read := Event{}
+		check(unmarshalMap(map[string]*dynamodb.AttributeValue{"at": {N: aws.String("1634651100123")}}, &read))
+		if !read.At.Equal(at) {
+			t.Errorf("the milliseconds should have been read as %v but were %v with the format %d", at, read.At, format)
+		}
+
+		check(unmarshalMap(map[string]*dynamodb.AttributeValue{"at": {N: aws.String("1634651100")}}, &read))
+		if !read.At.Equal(at.Truncate(time.Second)) {
+			t.Errorf("the seconds should have been read as %v but were %v with the format %d", at.Truncate(time.Second), read.At, format)
+		}
+	}
+}
+
+func TestStrictNestedStructsIgnoreCase(t *testing.T) {
+	defer SetMarshalingOptions(MarshalingOptions{})
+
+	SetMarshalingOptions(MarshalingOptions{Strict: true})
+
+	item := map[string]*dynamodb.AttributeValue{
+		"id":      {S: aws.String("1")},
+		"details": {M: map[string]*dynamodb.AttributeValue{"COUNT": {N: aws.String("2")}}},
+	}
+
+	read := Event{}
+	if err := unmarshalMap(item, &read); err != nil || read.Details == nil || read.Details.Count != 2 {
+		t.Errorf("the nested attributes are matched ignoring the case too: %v %+v", err, read.Details)
+	}
+
+	item["details"].M["Other"] = &dynamodb.AttributeValue{S: aws.String("x")}
+
+	if err := unmarshalMap(item, &read); err == nil {
+		t.Errorf("the unmapped nested attribute should have been rejected in strict mode")
+	}
+}
@@ -0,0 +1,261 @@
+package dynamodbutils
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/AmeDigital/aws-utils-go/sessionutils"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// CapacityMetric reports the capacity consumed on a table or on one of its indexes by a call to dynamodb.
+//   - Operation: the name of the dynamodb api operation, e.g. "GetItem" or "Query".
+//   - TableName: the table accessed.
+//   - IndexName: the index accessed, or empty when the capacity was consumed by the table itself.
+//   - ReadCapacityUnits and WriteCapacityUnits: the read and write units consumed.
+//   - Caller: the function, outside of dynamodbutils, that made the call, e.g. "main.saveOrder",
+//     allowing the costs to be attributed to the code paths. It is found on the stack of the goroutine
+//     making the call, so it is empty for the calls made by the goroutines started by the package, such
+//     as the workers of Backfill, and it is the function that started the goroutine for the calls made
+//     by goroutines started by the application.
+type CapacityMetric struct {
+	Operation          string
+	TableName          string
+	IndexName          string
+	ReadCapacityUnits  float64
+	WriteCapacityUnits float64
+	Caller             string
+}
+
+// ThrottleEvent reports a call to dynamodb rejected by throttling.
+//   - Operation and TableName: as in CapacityMetric. TableName is empty for operations on many tables.
+//   - ErrorCode: the error returned by dynamodb, e.g. "ProvisionedThroughputExceededException".
+//   - RetryCount: how many times the call had already been retried.
+//   - WillRetry: whether the call will be retried by the aws sdk or the error is returned to the caller.
+//   - Caller: the function that made the call, as in CapacityMetric.
+type ThrottleEvent struct {
+	Operation  string
+	TableName  string
+	ErrorCode  string
+	RetryCount int
+	WillRetry  bool
+	Caller     string
+}
+
+// MetricsHook receives the telemetry of the calls made to dynamodb by the functions of the package.
+// Its methods are called synchronously, so they must be fast and safe for concurrent use.
+type MetricsHook interface {
+	ConsumedCapacity(metric CapacityMetric)
+	Throttled(event ThrottleEvent)
+}
+
+var metricsHook MetricsHook
+
+// SetMetricsHook enables the telemetry of the calls made to dynamodb: every call requests its consumed
+// capacity (ReturnConsumedCapacity=INDEXES), which is reported to the hook together with the throttled
+// calls. Use SetMetricsHook(nil) to disable it.
+func SetMetricsHook(hook MetricsHook) {
+	metricsHook = hook
+}
+
+// readOperations are the operations whose consumed capacity is reported as read capacity when dynamodb
+// does not tell apart the read and write units (e.g. on tables with on-demand capacity).
+var readOperations = map[string]bool{
+	"GetItem":          true,
+	"BatchGetItem":     true,
+	"Query":            true,
+	"Scan":             true,
+	"TransactGetItems": true,
+	"ExecuteStatement": true,
+}
+
+// newClient creates the dynamodb client used by the functions of the package, with the telemetry
+// handlers attached when a MetricsHook is configured. The given configurations override the session's.
+func newClient(cfgs ...*aws.Config) *dynamodb.DynamoDB {
+	svc := dynamodb.New(sessionutils.Session, cfgs...)
+
+	hook := metricsHook
+	if hook == nil {
+		return svc
+	}
+
+	svc.Handlers.Build.PushFront(requestConsumedCapacity)
+
+	svc.Handlers.Complete.PushBack(func(r *request.Request) {
+		if r.Error == nil {
+			reportConsumedCapacity(hook, r)
+		}
+	})
+
+	svc.Handlers.AfterRetry.PushFront(func(r *request.Request) {
+		if r.Error != nil && request.IsErrorThrottle(r.Error) {
+			hook.Throttled(ThrottleEvent{
+				Operation:  r.Operation.Name,
+				TableName:  requestTableName(r),
+				ErrorCode:  errorCode(r.Error),
+				RetryCount: r.RetryCount,
+				WillRetry:  r.WillRetry(),
+				Caller:     caller(),
+			})
+		}
+	})
+
+	return svc
+}
+
+// requestConsumedCapacity sets ReturnConsumedCapacity on the inputs of the operations that support it.
+func requestConsumedCapacity(r *request.Request) {
+	params := reflect.ValueOf(r.Params)
+	if params.Kind() != reflect.Ptr || params.IsNil() {
+		return
+	}
+
+	field := params.Elem().FieldByName("ReturnConsumedCapacity")
+	if field.IsValid() && field.IsNil() {
+		field.Set(reflect.ValueOf(aws.String(dynamodb.ReturnConsumedCapacityIndexes)))
+	}
+}
+
+// reportConsumedCapacity sends to the hook the capacity consumed by a request, per table and index.
+func reportConsumedCapacity(hook MetricsHook, r *request.Request) {
+	data := reflect.ValueOf(r.Data)
+	if data.Kind() != reflect.Ptr || data.IsNil() {
+		return
+	}
+
+	field := data.Elem().FieldByName("ConsumedCapacity")
+	if !field.IsValid() {
+		return
+	}
+
+	consumed := []*dynamodb.ConsumedCapacity{}
+	switch value := field.Interface().(type) {
+	case *dynamodb.ConsumedCapacity:
+		consumed = append(consumed, value)
+	case []*dynamodb.ConsumedCapacity:
+		consumed = value
+	}
+
+	read := isReadRequest(r)
+	callerName := caller()
+
+	for _, c := range consumed {
+		if c == nil {
+			continue
+		}
+
+		tablename := aws.StringValue(c.TableName)
+
+		report := func(indexName string, capacity *dynamodb.Capacity) {
+			if capacity == nil {
+				return
+			}
+			metric := CapacityMetric{
+				Operation:          r.Operation.Name,
+				TableName:          tablename,
+				IndexName:          indexName,
+				ReadCapacityUnits:  aws.Float64Value(capacity.ReadCapacityUnits),
+				WriteCapacityUnits: aws.Float64Value(capacity.WriteCapacityUnits),
+				Caller:             callerName,
+			}
+			if capacity.ReadCapacityUnits == nil && capacity.WriteCapacityUnits == nil {
+				if read {
+					metric.ReadCapacityUnits = aws.Float64Value(capacity.CapacityUnits)
+				} else {
+					metric.WriteCapacityUnits = aws.Float64Value(capacity.CapacityUnits)
+				}
+			}
+			hook.ConsumedCapacity(metric)
+		}
+
+		if c.Table != nil {
+			report("", c.Table)
+		} else if c.GlobalSecondaryIndexes == nil && c.LocalSecondaryIndexes == nil {
+			// only the total was returned
+			report("", &dynamodb.Capacity{
+				ReadCapacityUnits:  c.ReadCapacityUnits,
+				WriteCapacityUnits: c.WriteCapacityUnits,
+				CapacityUnits:      c.CapacityUnits,
+			})
+		}
+
+		for indexName, capacity := range c.GlobalSecondaryIndexes {
+			report(indexName, capacity)
+		}
+		for indexName, capacity := range c.LocalSecondaryIndexes {
+			report(indexName, capacity)
+		}
+	}
+}
+
+// isReadRequest tells whether a request only reads items.
+func isReadRequest(r *request.Request) bool {
+	if input, ok := r.Params.(*dynamodb.ExecuteStatementInput); ok {
+		return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(aws.StringValue(input.Statement))), "SELECT")
+	}
+	return readOperations[r.Operation.Name]
+}
+
+// requestTableName returns the table accessed by a request, or an empty string if it has no single table.
+func requestTableName(r *request.Request) string {
+	params := reflect.ValueOf(r.Params)
+	if params.Kind() != reflect.Ptr || params.IsNil() {
+		return ""
+	}
+
+	field := params.Elem().FieldByName("TableName")
+	if !field.IsValid() {
+		return ""
+	}
+
+	tablename, _ := field.Interface().(*string)
+
+	return aws.StringValue(tablename)
+}
+
+func errorCode(err error) string {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code()
+	}
+	return err.Error()
+}
+
+// caller returns the name of the first function on the stack that is not part of dynamodbutils, of the aws
+// sdk or of the go runtime, or an empty string when the call was made by a goroutine of dynamodbutils.
+// The functions of the tests of dynamodbutils are returned as callers.
+func caller() string {
+	// the stack is read again with a larger buffer while it has only library frames and did not fit
+	for size := 32; ; size *= 2 {
+		pcs := make([]uintptr, size)
+		n := runtime.Callers(2, pcs)
+		frames := runtime.CallersFrames(pcs[:n])
+
+		for {
+			frame, more := frames.Next()
+			if !isLibraryFrame(frame) {
+				return frame.Function
+			}
+			if !more {
+				break
+			}
+		}
+
+		if n < size {
+			return ""
+		}
+	}
+}
+
+// isLibraryFrame tells whether a stack frame belongs to dynamodbutils (not counting its tests), to the aws sdk
+// or to the go runtime.
+func isLibraryFrame(frame runtime.Frame) bool {
+	if strings.HasPrefix(frame.Function, "github.com/AmeDigital/aws-utils-go/dynamodbutils.") {
+		return !strings.HasSuffix(frame.File, "_test.go")
+	}
+	return strings.HasPrefix(frame.Function, "github.com/aws/aws-sdk-go/") || strings.HasPrefix(frame.Function, "runtime.")
+}
@@ -0,0 +1,45 @@
+package dynamodbutils
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordingMetricsHook struct {
+	mutex   sync.Mutex
+	metrics []CapacityMetric
+}
+
+func (h *recordingMetricsHook) ConsumedCapacity(metric CapacityMetric) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.metrics = append(h.metrics, metric)
+}
+
+func (h *recordingMetricsHook) Throttled(event ThrottleEvent) {}
+
+func TestMetricsHook(t *testing.T) {
+	hook := &recordingMetricsHook{}
+	SetMetricsHook(hook)
+	defer SetMetricsHook(nil)
+
+	check(PutItem(tablename, City{State: "METRICS", Id: 1, Name: "Metered"}))
+	check(GetItem(tablename, Key{PKName: "State", PKValue: "METRICS", SKName: "Id", SKValue: 1}, &City{}))
+
+	if len(hook.metrics) < 2 {
+		t.Fatalf("at least 2 metrics should have been reported but got %+v", hook.metrics)
+	}
+
+	put, get := hook.metrics[0], hook.metrics[len(hook.metrics)-1]
+
+	if put.Operation != "PutItem" || put.TableName != tablename || put.WriteCapacityUnits <= 0 {
+		t.Errorf("unexpected metric for PutItem: %+v", put)
+	}
+	if get.Operation != "GetItem" || get.TableName != tablename || get.ReadCapacityUnits <= 0 {
+		t.Errorf("unexpected metric for GetItem: %+v", get)
+	}
+	if !strings.HasSuffix(get.Caller, "TestMetricsHook") {
+		t.Errorf("the caller should be TestMetricsHook but was '%s'", get.Caller)
+	}
+}
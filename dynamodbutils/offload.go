@@ -0,0 +1,262 @@
+package dynamodbutils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/AmeDigital/aws-utils-go/s3utils"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// S3OffloadConfig configures the offloading of large attributes to s3, which allows storing items
+// bigger than the 400 KB limit of dynamodb.
+//   - BucketName: the bucket where the attributes are stored.
+//   - KeyPrefix: optional prefix of the keys of the objects created on the bucket.
+//   - Threshold: the size in bytes above which an attribute is offloaded. The size considered is
+//     the one of the attribute serialized as json, which is also the format of the object stored on s3.
+//
+// Only the struct fields tagged with `dynamodbutils:"s3"` are offloaded, by PutItem and PutItemIf, and by
+// UpdateItem for the tables registered with RegisterS3OffloadFields. The attribute is replaced on the table
+// by a pointer to the s3 object, which GetItem, FindOneFromIndex, Query and BatchGetItem transparently
+// replace by the original value. The s3 objects are removed when the item is deleted by DeleteItem or when
+// its attribute is overwritten by PutItem or UpdateItem. Only the objects in BucketName under KeyPrefix
+// are ever deleted, and the writes of values shaped like a pointer are rejected.
+//
+// Example:
+//
+//	type Document struct {
+//	    Id      string
+//	    Content string `dynamodbutils:"s3"`
+//	}
+//
+// SetS3Offload(&S3OffloadConfig{BucketName: "documents-content", Threshold: 100 * 1024})
+type S3OffloadConfig struct {
+	BucketName string // mandatory
+	KeyPrefix  string // optional
+	Threshold  int    // mandatory
+}
+
+var s3Offload *S3OffloadConfig
+
+var registeredS3OffloadFields = make(map[string][]string)
+var registeredS3OffloadFieldsMutex sync.RWMutex
+
+// SetS3Offload enables offloading large attributes to s3. Use SetS3Offload(nil) to disable it; the items
+// already offloaded will still be read normally.
+func SetS3Offload(config *S3OffloadConfig) {
+	s3Offload = config
+}
+
+// RegisterS3OffloadFields tells UpdateItem and DeleteItem which are the attributes of the items of a table
+// offloaded to s3, taking them from the fields of the model tagged with `dynamodbutils:"s3"`. PutItem finds
+// them on the item itself and does not need the registration.
+//
+// UpdateItem offloads the registered attributes larger than the threshold. Without the registration it
+// does not offload any attribute and fails, instead of overwriting it, when an attribute being set is
+// offloaded on the table.
+//
+// Example:
+//
+// err := RegisterS3OffloadFields("Documents", Document{})
+func RegisterS3OffloadFields(tablename string, model interface{}) error {
+	names := offloadedAttributeNames(reflect.TypeOf(model))
+	if len(names) == 0 {
+		return errors.New("dynamodbutils.RegisterS3OffloadFields: the model has no fields tagged with s3")
+	}
+
+	registeredS3OffloadFieldsMutex.Lock()
+	defer registeredS3OffloadFieldsMutex.Unlock()
+
+	registeredS3OffloadFields[tablename] = names
+
+	return nil
+}
+
+// s3OffloadFieldsOfTable returns the attributes registered with RegisterS3OffloadFields, or nil.
+func s3OffloadFieldsOfTable(tablename string) []string {
+	registeredS3OffloadFieldsMutex.RLock()
+	defer registeredS3OffloadFieldsMutex.RUnlock()
+
+	return registeredS3OffloadFields[tablename]
+}
+
+// s3PointerAttributeName is the name of the single attribute of the map that replaces an offloaded attribute.
+// Its value is the location of the object, as "s3://bucket/key".
+const s3PointerAttributeName = "dynamodbutils:s3"
+
+type s3Location struct {
+	Bucket string
+	Key    string
+}
+
+func (l s3Location) String() string {
+	return "s3://" + l.Bucket + "/" + l.Key
+}
+
+// parseS3Pointer returns the location of the object an attribute points to, if it is an s3 pointer.
+func parseS3Pointer(attribute *dynamodb.AttributeValue) (location s3Location, ok bool) {
+	if attribute == nil || len(attribute.M) != 1 {
+		return location, false
+	}
+
+	pointer, ok := attribute.M[s3PointerAttributeName]
+	if !ok || pointer.S == nil || !strings.HasPrefix(*pointer.S, "s3://") {
+		return location, false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(*pointer.S, "s3://"), "/", 2)
+	if len(parts) != 2 {
+		return location, false
+	}
+
+	return s3Location{Bucket: parts[0], Key: parts[1]}, true
+}
+
+// offloadedKeyRegexp matches the end of the keys of the objects created by offloadAttributes.
+var offloadedKeyRegexp = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// ownsObject tells whether an s3 object may have been created by offloadAttributes: it is in the bucket and
+// under the prefix of the configuration. The other objects are never deleted.
+func ownsObject(location s3Location) bool {
+	config := s3Offload
+	return config != nil && location.Bucket == config.BucketName &&
+		strings.HasPrefix(location.Key, config.KeyPrefix) &&
+		offloadedKeyRegexp.MatchString(strings.TrimPrefix(location.Key, config.KeyPrefix))
+}
+
+// checkS3Pointers fails if any of the attributes to be written has the format of an s3 pointer, so the
+// pointers on the table are only the ones created by offloadAttributes.
+func checkS3Pointers(item map[string]*dynamodb.AttributeValue) error {
+	for name, attribute := range item {
+		if _, ok := parseS3Pointer(attribute); ok {
+			return errors.New("dynamodbutils: the attribute '" + name + "' has the format reserved to the attributes offloaded to s3")
+		}
+	}
+	return nil
+}
+
+// offloadAttributes uploads to s3 the given attributes of the item bigger than the threshold and
+// replaces them by pointers. The item given is modified.
+func offloadAttributes(names []string, item map[string]*dynamodb.AttributeValue) (map[string]*dynamodb.AttributeValue, []s3Location, error) {
+	config := s3Offload
+	if config == nil || len(names) == 0 {
+		return item, nil, nil
+	}
+
+	offloaded := []s3Location{}
+
+	for _, name := range names {
+		attribute, ok := item[name]
+		if !ok {
+			continue
+		}
+
+		content, err := json.Marshal(attribute)
+		if err != nil {
+			return nil, offloaded, err
+		}
+
+		if len(content) <= config.Threshold {
+			continue
+		}
+
+		location := s3Location{Bucket: config.BucketName, Key: config.KeyPrefix + randomObjectKey()}
+
+		_, err = s3utils.PutObject(location.Bucket, location.Key, string(content))
+		if err != nil {
+			deleteOffloadedObjects(offloaded)
+			return nil, nil, err
+		}
+
+		offloaded = append(offloaded, location)
+
+		item[name] = &dynamodb.AttributeValue{
+			M: map[string]*dynamodb.AttributeValue{
+				s3PointerAttributeName: {S: aws.String(location.String())},
+			},
+		}
+	}
+
+	return item, offloaded, nil
+}
+
+// rehydrateAttributes returns a copy of the item with the attributes offloaded to s3 replaced by their values.
+// If the item has no offloaded attributes it is returned as is.
+func rehydrateAttributes(item map[string]*dynamodb.AttributeValue) (map[string]*dynamodb.AttributeValue, error) {
+	var rehydrated map[string]*dynamodb.AttributeValue
+
+	for name, attribute := range item {
+		location, ok := parseS3Pointer(attribute)
+		if !ok {
+			continue
+		}
+
+		if rehydrated == nil {
+			rehydrated = make(map[string]*dynamodb.AttributeValue, len(item))
+			for k, v := range item {
+				rehydrated[k] = v
+			}
+		}
+
+		content, err := s3utils.GetObject(location.Bucket, location.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		value := &dynamodb.AttributeValue{}
+		if err = json.Unmarshal(content, value); err != nil {
+			return nil, errors.New("dynamodbutils: could not read the attribute '" + name + "' from " + location.String() + ": " + err.Error())
+		}
+
+		rehydrated[name] = value
+	}
+
+	if rehydrated == nil {
+		return item, nil
+	}
+
+	return rehydrated, nil
+}
+
+// offloadedObjects returns the locations of the s3 objects created by offloadAttributes referenced by the
+// given attributes of an item, or by any of its attributes if 'names' is nil.
+func offloadedObjects(item map[string]*dynamodb.AttributeValue, names []string) []s3Location {
+	if names == nil {
+		for name := range item {
+			names = append(names, name)
+		}
+	}
+
+	locations := []s3Location{}
+	for _, name := range names {
+		if location, ok := parseS3Pointer(item[name]); ok && ownsObject(location) {
+			locations = append(locations, location)
+		}
+	}
+	return locations
+}
+
+// deleteOffloadedObjects removes the given objects from s3, returning the last error found, if any.
+func deleteOffloadedObjects(locations []s3Location) (err error) {
+	for _, location := range locations {
+		if deleteErr := s3utils.DeleteObject(location.Bucket, location.Key); deleteErr != nil {
+			err = errors.New("dynamodbutils: could not delete the offloaded attribute " + location.String() + ": " + deleteErr.Error())
+		}
+	}
+	return err
+}
+
+// randomObjectKey generates a unique name for an s3 object holding an offloaded attribute.
+func randomObjectKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,143 @@
+package dynamodbutils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AmeDigital/aws-utils-go/s3utils"
+	"github.com/AmeDigital/aws-utils-go/sessionutils"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+type Document struct {
+	State   string
+	Id      int
+	Content string `dynamodbutils:"s3"`
+}
+
+func TestParseS3Pointer(t *testing.T) {
+	pointer := &dynamodb.AttributeValue{
+		M: map[string]*dynamodb.AttributeValue{
+			s3PointerAttributeName: {S: aws.String("s3://documents/prefix/0a1b2c")},
+		},
+	}
+
+	location, ok := parseS3Pointer(pointer)
+	if !ok {
+		t.Fatal("the attribute should be recognized as an s3 pointer")
+	}
+	if location.Bucket != "documents" || location.Key != "prefix/0a1b2c" {
+		t.Errorf("unexpected location %+v", location)
+	}
+
+	notPointer := &dynamodb.AttributeValue{
+		M: map[string]*dynamodb.AttributeValue{
+			"url": {S: aws.String("s3://documents/prefix/0a1b2c")},
+		},
+	}
+
+	if _, ok := parseS3Pointer(notPointer); ok {
+		t.Error("a regular map should not be recognized as an s3 pointer")
+	}
+}
+
+func TestTaggedAttributeNames(t *testing.T) {
+	type Document struct {
+		Id      string `json:"id"`
+		Content string `json:"content" dynamodbutils:"s3"`
+		Summary string `dynamodbav:"summary" json:"abstract" dynamodbutils:"s3"`
+		Raw     []byte `dynamodbutils:"s3"`
+	}
+
+	names := taggedAttributeNames(reflect.TypeOf(Document{}), "s3")
+	expected := []string{"content", "summary", "Raw"}
+
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("names should be %v but were %v", expected, names)
+	}
+}
+
+func TestPutItemGetItemAndDeleteItemWithOffload(t *testing.T) {
+	table := "documents"
+	createTable(table)
+	defer dynamodbClient.DeleteTable(&dynamodb.DeleteTableInput{TableName: &table})
+
+	bucket := "offloaded-attributes"
+	s3Client := s3.New(sessionutils.Session)
+	_, err := s3Client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	check(err)
+
+	SetS3Offload(&S3OffloadConfig{BucketName: bucket, KeyPrefix: "documents/", Threshold: 100})
+	defer SetS3Offload(nil)
+
+	key := Key{PKName: "State", PKValue: "S3", SKName: "Id", SKValue: 1}
+	document := Document{State: "S3", Id: 1, Content: strings.Repeat("content ", 100)}
+	check(PutItem(table, document))
+
+	objects, err := s3utils.ListObjects(bucket, "documents/")
+	check(err)
+	if len(objects) != 1 {
+		t.Fatalf("the content should have been offloaded to 1 object but %d were created", len(objects))
+	}
+
+	found := Document{}
+	check(GetItem(table, key, &found))
+	if !reflect.DeepEqual(found, document) {
+		t.Errorf("Expected: %+v, Result: %+v", document, found)
+	}
+
+	// UpdateItem offloads the registered attributes and deletes the objects overwritten
+	check(RegisterS3OffloadFields(table, Document{}))
+	document.Content = strings.Repeat("updated ", 100)
+	check(UpdateItem(table, key, map[string]interface{}{"Content": document.Content}))
+
+	check(GetItem(table, key, &found))
+	if !reflect.DeepEqual(found, document) {
+		t.Errorf("Expected: %+v, Result: %+v", document, found)
+	}
+	if updated, err := s3utils.ListObjects(bucket, "documents/"); err != nil || len(updated) != 1 || *updated[0] == *objects[0] {
+		t.Errorf("the updated content should have replaced the object %s, but the objects are %v, %v", *objects[0], aws.StringValueSlice(updated), err)
+	}
+
+	check(DeleteItem(table, key))
+
+	if objects, err = s3utils.ListObjects(bucket, "documents/"); err != nil || len(objects) != 0 {
+		t.Errorf("the object should have been deleted with the item, but the objects are %v, %v", aws.StringValueSlice(objects), err)
+	}
+}
+
+func TestOffloadOnlyDeletesItsObjects(t *testing.T) {
+	bucket := "offload-owned-objects"
+	s3Client := s3.New(sessionutils.Session)
+	_, err := s3Client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	check(err)
+
+	_, err = s3utils.PutObject(bucket, "other/object", "not offloaded")
+	check(err)
+
+	SetS3Offload(&S3OffloadConfig{BucketName: bucket, KeyPrefix: "documents/", Threshold: 100})
+	defer SetS3Offload(nil)
+
+	pointer := map[string]interface{}{s3PointerAttributeName: "s3://" + bucket + "/other/object"}
+
+	// a value shaped like a pointer cannot be written
+	if err = PutItem(tablename, map[string]interface{}{"State": "S3", "Id": 2, "Content": pointer}); err == nil {
+		t.Error("the pointer written by the application should have been rejected")
+	}
+
+	// nor is the object it points to deleted if the pointer is written by other means
+	item, err := marshalMap(map[string]interface{}{"State": "S3", "Id": 2, "Content": pointer})
+	check(err)
+	_, err = dynamodbClient.PutItem(&dynamodb.PutItemInput{TableName: aws.String(tablename), Item: item})
+	check(err)
+
+	check(DeleteItem(tablename, Key{PKName: "State", PKValue: "S3", SKName: "Id", SKValue: 2}))
+
+	if _, err = s3utils.GetObject(bucket, "other/object"); err != nil {
+		t.Errorf("the object out of the offload prefix should not have been deleted: %v", err)
+	}
+}
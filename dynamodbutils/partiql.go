@@ -0,0 +1,282 @@
+package dynamodbutils
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Statement is a PartiQL statement and the values of its parameters, which replace the '?' placeholders
+// of the statement in the same order.
+//
+// Example:
+//
+// Statement{Statement: `SELECT * FROM "cities" WHERE State = ? AND Id = ?`, Parameters: []interface{}{"MG", 1}}
+type Statement struct {
+	Statement  string
+	Parameters []interface{} // optional
+}
+
+// maxBatchStatements is the maximum number of statements accepted by BatchExecuteStatement.
+const maxBatchStatements = 25
+
+// ExecuteStatement runs a PartiQL statement and, if 'pointerToOutputSlice' is not nil, fills the slice it
+// points to with the items returned, the same way Query does. All the pages of the results are read.
+//
+// The items marked as deleted by SoftDelete are skipped when the output type has a deletedAt field, as
+// Query does, but they are filtered after being read: put the condition on the statement to save capacity.
+//
+// The writes made by PartiQL statements do not invalidate the cache configured with SetCache.
+//
+// Example:
+//
+// cities := []City{}
+//
+// err := ExecuteStatement(`SELECT * FROM "cities" WHERE State = ?`, []interface{}{"MG"}, &cities)
+func ExecuteStatement(statement string, parameters []interface{}, pointerToOutputSlice interface{}) error {
+	if err := checkOutputSlice("ExecuteStatement", pointerToOutputSlice); err != nil {
+		return err
+	}
+
+	attributeParameters, err := marshalParameters(parameters)
+	if err != nil {
+		return err
+	}
+
+	svc := newClient()
+
+	input := &dynamodb.ExecuteStatementInput{
+		Statement:  aws.String(statement),
+		Parameters: attributeParameters,
+	}
+
+	items := []map[string]*dynamodb.AttributeValue{}
+
+	for {
+		output, err := svc.ExecuteStatement(input)
+		if err != nil {
+			return err
+		}
+
+		items = append(items, output.Items...)
+
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+
+	if pointerToOutputSlice == nil {
+		return nil
+	}
+
+	items = skipSoftDeleted(items, auditFieldsOf(reflect.TypeOf(pointerToOutputSlice)).DeletedAt)
+	if len(items) == 0 {
+		return nil
+	}
+
+	return unmarshalItems(statementTableName(statement), items, pointerToOutputSlice, statementProjects(statement))
+}
+
+// BatchExecuteStatement runs a list of PartiQL statements, in groups of 25, which must be all reads or
+// all writes. The statements are not run in a transaction: each one may succeed or fail independently.
+//
+// The returned 'errs' has the error of each statement, or nil for the statements that succeeded.
+// The returned 'err' is only set when a whole batch failed: the statements of that batch and of the
+// following ones, which were not run, have it as their error, and the results of the batches that ran
+// are still returned.
+//
+// If 'pointerToOutputSlice' is not nil the slice it points to is filled with one element per statement,
+// holding the item read by the statement, or the zero value if it did not return any item. The items marked
+// as deleted by SoftDelete are returned as the zero value when the output type has a deletedAt field.
+func BatchExecuteStatement(statements []Statement, pointerToOutputSlice interface{}) (errs []error, err error) {
+	if err := checkOutputSlice("BatchExecuteStatement", pointerToOutputSlice); err != nil {
+		return nil, err
+	}
+
+	svc := newClient()
+
+	errs = make([]error, len(statements))
+	items := make([]map[string]*dynamodb.AttributeValue, len(statements))
+
+	for start := 0; start < len(statements) && err == nil; start += maxBatchStatements {
+		end := start + maxBatchStatements
+		if end > len(statements) {
+			end = len(statements)
+		}
+
+		err = executeStatementBatch(svc, statements[start:end], errs[start:end], items[start:end])
+		if err != nil {
+			for i := start; i < len(statements); i++ {
+				errs[i] = err
+			}
+		}
+	}
+
+	if pointerToOutputSlice == nil {
+		return errs, err
+	}
+
+	deletedAt := auditFieldsOf(reflect.TypeOf(pointerToOutputSlice)).DeletedAt
+
+	// each item is decoded with the table of its own statement
+	for i, item := range items {
+		if item == nil || isSoftDeleted(item, deletedAt) {
+			items[i] = map[string]*dynamodb.AttributeValue{}
+			continue
+		}
+
+		items[i], errs[i] = decodeItem(statementTableName(statements[i].Statement), item, statementProjects(statements[i].Statement))
+		if errs[i] != nil {
+			items[i] = map[string]*dynamodb.AttributeValue{}
+		}
+	}
+
+	if unmarshalErr := unmarshalListOfMaps(items, pointerToOutputSlice); unmarshalErr != nil && err == nil {
+		err = unmarshalErr
+	}
+
+	return errs, err
+}
+
+// executeStatementBatch runs a batch of up to 25 statements, storing the error and the item of each one.
+func executeStatementBatch(svc *dynamodb.DynamoDB, statements []Statement, errs []error, items []map[string]*dynamodb.AttributeValue) error {
+	input := &dynamodb.BatchExecuteStatementInput{}
+
+	for _, statement := range statements {
+		request, err := statement.request()
+		if err != nil {
+			return err
+		}
+		input.Statements = append(input.Statements, request)
+	}
+
+	output, err := svc.BatchExecuteStatement(input)
+	if err != nil {
+		return err
+	}
+
+	for i, response := range output.Responses {
+		if response.Error != nil {
+			errs[i] = fmt.Errorf("%s: %s", aws.StringValue(response.Error.Code), aws.StringValue(response.Error.Message))
+		}
+		items[i] = response.Item
+	}
+
+	return nil
+}
+
+// skipSoftDeleted removes from a list the items having the deletedAt attribute set.
+func skipSoftDeleted(items []map[string]*dynamodb.AttributeValue, deletedAt string) []map[string]*dynamodb.AttributeValue {
+	if len(deletedAt) == 0 {
+		return items
+	}
+
+	kept := make([]map[string]*dynamodb.AttributeValue, 0, len(items))
+	for _, item := range items {
+		if !isSoftDeleted(item, deletedAt) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// ExecuteTransaction runs a list of PartiQL statements in a transaction: either all of them succeed or none does.
+//
+// The errors returned are:
+//   - TransactionCanceledException: the transaction was cancelled, e.g. because one of its conditions failed.
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/dynamodb/#DynamoDB.ExecuteTransaction
+func ExecuteTransaction(statements []Statement) error {
+	if len(statements) == 0 {
+		return errors.New("dynamodbutils.ExecuteTransaction: no statements were given")
+	}
+
+	input := &dynamodb.ExecuteTransactionInput{}
+
+	for _, statement := range statements {
+		request, err := statement.request()
+		if err != nil {
+			return err
+		}
+		input.TransactStatements = append(input.TransactStatements, &dynamodb.ParameterizedStatement{
+			Statement:  request.Statement,
+			Parameters: request.Parameters,
+		})
+	}
+
+	svc := newClient()
+
+	_, err := svc.ExecuteTransaction(input)
+
+	return err
+}
+
+func (s Statement) request() (*dynamodb.BatchStatementRequest, error) {
+	parameters, err := marshalParameters(s.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dynamodb.BatchStatementRequest{
+		Statement:  aws.String(s.Statement),
+		Parameters: parameters,
+	}, nil
+}
+
+// marshalParameters converts the parameters of a statement into the dynamodb format.
+func marshalParameters(parameters []interface{}) ([]*dynamodb.AttributeValue, error) {
+	if len(parameters) == 0 {
+		return nil, nil
+	}
+
+	attributes := make([]*dynamodb.AttributeValue, 0, len(parameters))
+
+	for _, parameter := range parameters {
+		attribute, err := marshalValue(parameter)
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, attribute)
+	}
+
+	return attributes, nil
+}
+
+// checkOutputSlice checks that the output argument is nil or a pointer to a slice.
+func checkOutputSlice(functionName string, pointerToOutputSlice interface{}) error {
+	if pointerToOutputSlice == nil {
+		return nil
+	}
+
+	rv := reflect.ValueOf(pointerToOutputSlice)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("dynamodbutils.%s: pointerToOutputSlice must be a slice pointer", functionName)
+	}
+
+	return nil
+}
+
+var statementTableRegexp = regexp.MustCompile(`(?i)\b(?:FROM|INTO|UPDATE)\s+(?:"([^"]+)"|([A-Za-z0-9_\-]+))`)
+
+// statementTableName finds the name of the table a statement reads or writes, which is needed to check
+// the signature of encrypted items. It returns an empty string if the name is not found.
+func statementTableName(statement string) string {
+	match := statementTableRegexp.FindStringSubmatch(statement)
+	if match == nil {
+		return ""
+	}
+	return match[1] + match[2]
+}
+
+var selectAllRegexp = regexp.MustCompile(`(?i)^\s*SELECT\s+\*\s+FROM\b`)
+var selectRegexp = regexp.MustCompile(`(?i)^\s*SELECT\b`)
+
+// statementProjects tells whether a statement selects only some of the attributes of the items, so the
+// signature of encrypted items cannot be checked.
+func statementProjects(statement string) bool {
+	return selectRegexp.MatchString(statement) && !selectAllRegexp.MatchString(statement)
+}
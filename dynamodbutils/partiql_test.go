@@ -0,0 +1,105 @@
+package dynamodbutils
+
+import (
+	"testing"
+)
+
+func TestStatementTableName(t *testing.T) {
+	statements := map[string]string{
+		`SELECT * FROM "cities" WHERE State = ?`:             "cities",
+		`SELECT * FROM "cities"."NameToPkSk" WHERE Name = ?`: "cities",
+		`select Name from cities where State = ?`:            "cities",
+		`INSERT INTO "my.table" VALUE {'Id': ?}`:             "my.table",
+		`UPDATE "cities" SET Population = ? WHERE Id = ?`:    "cities",
+		`DELETE FROM cities WHERE State = ? AND Id = ?`:      "cities",
+	}
+
+	for statement, expected := range statements {
+		if name := statementTableName(statement); name != expected {
+			t.Errorf("the table of '%s' should be '%s' but was '%s'", statement, expected, name)
+		}
+	}
+}
+
+func TestStatementProjects(t *testing.T) {
+	statements := map[string]bool{
+		`SELECT * FROM "cities" WHERE State = ?`:          false,
+		`  select *  from cities`:                         false,
+		`SELECT Name, Document FROM "cities"`:             true,
+		`UPDATE "cities" SET Population = ? WHERE Id = ?`: false,
+		`INSERT INTO "cities" VALUE {'Id': ?}`:            false,
+	}
+
+	for statement, expected := range statements {
+		if projects := statementProjects(statement); projects != expected {
+			t.Errorf("statementProjects('%s') should be %v but was %v", statement, expected, projects)
+		}
+	}
+}
+
+func TestExecuteStatement(t *testing.T) {
+	check(PutItem(tablename, City{State: "PQL", Id: 1, Name: "Partiql"}))
+	check(PutItem(tablename, City{State: "PQL", Id: 2, Name: "Partiql Two"}))
+
+	cities := []City{}
+	check(ExecuteStatement(`SELECT * FROM "cities" WHERE State = ?`, []interface{}{"PQL"}, &cities))
+
+	if len(cities) != 2 {
+		t.Errorf("cities should have length 2 but has %d", len(cities))
+	}
+
+	statements := []Statement{
+		{Statement: `UPDATE "cities" SET Population = ? WHERE State = ? AND Id = ?`, Parameters: []interface{}{10, "PQL", 1}},
+		{Statement: `UPDATE "cities" SET Population = ? WHERE State = ? AND Id = ?`, Parameters: []interface{}{20, "PQL", 2}},
+	}
+	check(ExecuteTransaction(statements))
+
+	statements = []Statement{
+		{Statement: `SELECT * FROM "cities" WHERE State = ? AND Id = ?`, Parameters: []interface{}{"PQL", 1}},
+		{Statement: `SELECT * FROM "cities" WHERE State = ? AND Id = ?`, Parameters: []interface{}{"PQL", 3}},
+	}
+
+	cities = []City{}
+	errs, err := BatchExecuteStatement(statements, &cities)
+	check(err)
+
+	if errs[0] != nil || errs[1] != nil {
+		t.Errorf("the statements should not have failed: %v", errs)
+	}
+	if len(cities) != 2 || cities[0].Population != 10 || cities[1].Id != 0 {
+		t.Errorf("unexpected result %+v", cities)
+	}
+}
+
+func TestExecuteStatementSkipsSoftDeletedItems(t *testing.T) {
+	check(RegisterAuditFields(tablename, AuditedCity{}))
+	defer func() {
+		registeredAuditFieldsMutex.Lock()
+		delete(registeredAuditFields, tablename)
+		registeredAuditFieldsMutex.Unlock()
+	}()
+
+	check(PutItem(tablename, AuditedCity{State: "PQL-DELETED", Id: 1, Name: "Kept"}))
+	check(PutItem(tablename, AuditedCity{State: "PQL-DELETED", Id: 2, Name: "Deleted"}))
+	check(SoftDelete(tablename, Key{PKName: "State", PKValue: "PQL-DELETED", SKName: "Id", SKValue: 2}))
+
+	cities := []AuditedCity{}
+	check(ExecuteStatement(`SELECT * FROM "cities" WHERE State = ?`, []interface{}{"PQL-DELETED"}, &cities))
+
+	if len(cities) != 1 || cities[0].Id != 1 {
+		t.Errorf("only the item not deleted should have been returned but got %+v", cities)
+	}
+
+	statements := []Statement{
+		{Statement: `SELECT * FROM "cities" WHERE State = ? AND Id = ?`, Parameters: []interface{}{"PQL-DELETED", 1}},
+		{Statement: `SELECT * FROM "cities" WHERE State = ? AND Id = ?`, Parameters: []interface{}{"PQL-DELETED", 2}},
+	}
+
+	cities = []AuditedCity{}
+	errs, err := BatchExecuteStatement(statements, &cities)
+	check(err)
+
+	if errs[0] != nil || errs[1] != nil || len(cities) != 2 || cities[0].Id != 1 || cities[1].Id != 0 {
+		t.Errorf("the deleted item should have been returned as the zero value but got %+v %v", cities, errs)
+	}
+}
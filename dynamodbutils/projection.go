@@ -0,0 +1,85 @@
+package dynamodbutils
+
+import (
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// ReadOptions holds the optional settings of GetItemWithOptions, FindOneFromIndexWithOptions and
+// BatchGetItemWithOptions.
+//   - Attributes: the names of the attributes to be read (the projection). Nested attributes can be
+//     given as paths, e.g. "address.city".
+//   - ProjectFromOutput: when true, the projection is built from the fields of the output struct, so only
+//     the attributes that will be unmarshaled are read. It is added to the names given in Attributes.
+//   - ConsistentRead: when true a strongly consistent read is made. Not supported by global secondary indexes.
+//   - IncludeDeleted: when true the items marked as deleted by SoftDelete are read too.
+//
+// Projected and consistent reads do not use the items on the cache configured with SetCache.
+type ReadOptions struct {
+	Attributes        []string // optional
+	ProjectFromOutput bool     // optional
+	ConsistentRead    bool     // optional
+	IncludeDeleted    bool     // optional
+}
+
+// projectionAttributes returns the attributes to be read according to the options, or nil if the
+// whole item must be read. 'outputType' is the type of the item being unmarshaled.
+func (opts ReadOptions) projectionAttributes(outputType reflect.Type) []string {
+	attributes := append([]string{}, opts.Attributes...)
+
+	if opts.ProjectFromOutput {
+		attributes = append(attributes, structAttributeNames(outputType)...)
+	}
+
+	// the deletedAt attribute is needed to skip the items marked as deleted
+	if deletedAt := opts.deletedAtAttribute(outputType); len(attributes) > 0 && len(deletedAt) > 0 {
+		attributes = append(attributes, deletedAt)
+	}
+
+	// the encrypted attributes can only be read with the encryption metadata of the item
+	if len(attributes) > 0 && keyProvider != nil {
+		attributes = append(attributes, encryptionAttributeName)
+	}
+
+	return attributes
+}
+
+// projects tells whether only some of the attributes of the items are read.
+func (opts ReadOptions) projects(outputType reflect.Type) bool {
+	return len(opts.projectionAttributes(outputType)) > 0
+}
+
+// deletedAtAttribute returns the name of the deletedAt attribute of the output type if the items
+// marked as deleted must be skipped, or an empty string otherwise.
+func (opts ReadOptions) deletedAtAttribute(outputType reflect.Type) string {
+	if opts.IncludeDeleted {
+		return ""
+	}
+	return auditFieldsOf(outputType).DeletedAt
+}
+
+// usesCache tells whether the items on the cache can be used to answer a read with these options.
+func (opts ReadOptions) usesCache() bool {
+	return len(opts.Attributes) == 0 && !opts.ProjectFromOutput && !opts.ConsistentRead
+}
+
+// buildProjection builds the projection expression for the given attribute names.
+// It returns false if there are no attributes to project.
+func buildProjection(attributes []string) (projection expression.ProjectionBuilder, ok bool) {
+	if len(attributes) == 0 {
+		return projection, false
+	}
+
+	seen := make(map[string]bool)
+	names := []expression.NameBuilder{}
+
+	for _, attribute := range attributes {
+		if !seen[attribute] {
+			seen[attribute] = true
+			names = append(names, expression.Name(attribute))
+		}
+	}
+
+	return expression.NamesList(names[0], names[1:]...), true
+}
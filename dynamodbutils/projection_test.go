@@ -0,0 +1,70 @@
+package dynamodbutils
+
+import (
+	"reflect"
+	"testing"
+)
+
+type CityName struct {
+	State string
+	Id    int
+	Name  string
+}
+
+func TestStructAttributeNames(t *testing.T) {
+	type Base struct {
+		Id int `dynamodbav:"id"`
+	}
+	type Item struct {
+		Base
+		Name    string `dynamodbav:"name,omitempty"`
+		Ignored string `dynamodbav:"-"`
+		hidden  string
+		Aliases []string
+		Code    string `json:"code"`
+		Both    string `dynamodbav:"both" json:"json_both"`
+		Skipped string `json:"-"`
+	}
+
+	names := structAttributeNames(reflect.TypeOf(&[]Item{}))
+	expected := []string{"id", "name", "Aliases", "code", "both"}
+
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("names should be %v but were %v", expected, names)
+	}
+}
+
+func TestGetItemWithProjection(t *testing.T) {
+	city := City{State: "PR", Id: 1, Name: "Curitiba", Population: 1900000, Aliases: []string{"Curita"}}
+	check(PutItem(tablename, city))
+
+	key := Key{PKName: "State", PKValue: "PR", SKName: "Id", SKValue: 1}
+
+	found := City{}
+	check(GetItemWithOptions(tablename, key, &found, ReadOptions{Attributes: []string{"Name"}, ConsistentRead: true}))
+
+	if !reflect.DeepEqual(found, City{Name: "Curitiba"}) {
+		t.Errorf("only the Name should have been read but got %+v", found)
+	}
+
+	cityName := CityName{}
+	check(GetItemWithOptions(tablename, key, &cityName, ReadOptions{ProjectFromOutput: true}))
+
+	if !reflect.DeepEqual(cityName, CityName{State: "PR", Id: 1, Name: "Curitiba"}) {
+		t.Errorf("the fields of CityName should have been read but got %+v", cityName)
+	}
+
+	cityName = CityName{}
+	check(FindOneFromIndexWithOptions(tablename, indexname, Key{PKName: "Name", PKValue: "Curitiba"}, &cityName, ReadOptions{Attributes: []string{"Id"}}))
+
+	if !reflect.DeepEqual(cityName, CityName{Id: 1}) {
+		t.Errorf("only the Id should have been read but got %+v", cityName)
+	}
+
+	cities := []City{}
+	check(BatchGetItemWithOptions(tablename, []Key{key}, &cities, ReadOptions{Attributes: []string{"Population"}}))
+
+	if len(cities) != 1 || !reflect.DeepEqual(cities[0], City{State: "PR", Id: 1, Population: 1900000}) {
+		t.Errorf("only the key and Population should have been read but got %+v", cities)
+	}
+}
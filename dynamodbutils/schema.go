@@ -0,0 +1,59 @@
+package dynamodbutils
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// tableDescriptions caches the descriptions of the tables, which are used to find their key schemas.
+var tableDescriptions = make(map[string]*dynamodb.TableDescription)
+var tableDescriptionsMutex sync.Mutex
+
+// describeTable returns the description of a table. It is only read from dynamodb on the first call.
+func describeTable(tablename string) (*dynamodb.TableDescription, error) {
+	tableDescriptionsMutex.Lock()
+	defer tableDescriptionsMutex.Unlock()
+
+	if description, ok := tableDescriptions[tablename]; ok {
+		return description, nil
+	}
+
+	svc := newClient()
+
+	output, err := svc.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(tablename),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tableDescriptions[tablename] = output.Table
+
+	return output.Table, nil
+}
+
+// tableKeyNames returns the names of the partition key and of the sort key (empty if the table has none) of a table.
+func tableKeyNames(tablename string) (pkName string, skName string, err error) {
+	description, err := describeTable(tablename)
+	if err != nil {
+		return "", "", err
+	}
+
+	pkName, skName = keySchemaNames(description.KeySchema)
+
+	return pkName, skName, nil
+}
+
+// keySchemaNames returns the names of the partition key and of the sort key of a key schema.
+func keySchemaNames(keySchema []*dynamodb.KeySchemaElement) (pkName string, skName string) {
+	for _, element := range keySchema {
+		if aws.StringValue(element.KeyType) == dynamodb.KeyTypeHash {
+			pkName = aws.StringValue(element.AttributeName)
+		} else {
+			skName = aws.StringValue(element.AttributeName)
+		}
+	}
+	return pkName, skName
+}
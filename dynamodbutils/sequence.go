@@ -0,0 +1,114 @@
+package dynamodbutils
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// SequenceAttributeName is the name of the numeric attribute that holds the current value
+// of the sequences managed by NextSequence and SequenceAllocator.
+var SequenceAttributeName = "SequenceValue"
+
+// NextSequence atomically increments by 'step' the sequence stored on the item identified by 'key'
+// and returns the new value. If the item (or its sequence attribute) does not exist yet it is created
+// and the sequence starts from zero, so the first value returned is 'step'.
+//
+// Example:
+//
+// key := Key{PKName: "tenantId", PKValue: "tenant-1", SKName: "sequenceName", SKValue: "orderNumber"}
+//
+// orderNumber, err := NextSequence("Sequences", key, 1)
+func NextSequence(tablename string, key Key, step int64) (value int64, err error) {
+	if step <= 0 {
+		return 0, errors.New("dynamodbutils.NextSequence: step must be greater than zero")
+	}
+
+	svc := newClient()
+
+	keyAttributes, err := marshalKey(key)
+	if err != nil {
+		return 0, err
+	}
+
+	update := expression.Add(expression.Name(SequenceAttributeName), expression.Value(step))
+
+	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return 0, err
+	}
+
+	output, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                 aws.String(tablename),
+		Key:                       keyAttributes,
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		ReturnValues:              aws.String(dynamodb.ReturnValueUpdatedNew),
+	})
+
+	invalidateCachedKey(tablename, keyAttributes)
+
+	if err != nil {
+		return 0, err
+	}
+
+	attribute, ok := output.Attributes[SequenceAttributeName]
+	if !ok || attribute.N == nil {
+		return 0, errors.New("dynamodbutils.NextSequence: the update did not return the sequence value")
+	}
+
+	return strconv.ParseInt(*attribute.N, 10, 64)
+}
+
+// SequenceAllocator hands out values of a sequence stored on dynamodb reserving them in blocks of
+// 'BlockSize' values, so only one write is made to the table for every BlockSize values handed out.
+//
+// The values are unique and increasing for a single allocator, but when many allocators (i.e. many
+// processes) share the same sequence each one reserves its own blocks, so the values are not
+// handed out in global order and values left unused in a block are lost when the process exits.
+//
+// A SequenceAllocator is safe for concurrent use.
+type SequenceAllocator struct {
+	TableName string
+	Key       Key
+	BlockSize int64
+
+	mutex sync.Mutex
+	next  int64 // next value to be handed out
+	limit int64 // last value of the reserved block
+}
+
+// NewSequenceAllocator creates a SequenceAllocator for the sequence stored on the item identified by 'key'.
+func NewSequenceAllocator(tablename string, key Key, blockSize int64) *SequenceAllocator {
+	return &SequenceAllocator{
+		TableName: tablename,
+		Key:       key,
+		BlockSize: blockSize,
+	}
+}
+
+// Next returns the next value of the sequence, reserving a new block on the table when the
+// current block is exhausted.
+func (a *SequenceAllocator) Next() (int64, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.next == 0 || a.next > a.limit {
+		limit, err := NextSequence(a.TableName, a.Key, a.BlockSize)
+		if err != nil {
+			return 0, err
+		}
+		a.next = limit - a.BlockSize + 1
+		a.limit = limit
+	}
+
+	value := a.next
+	a.next++
+
+	return value, nil
+}
@@ -0,0 +1,51 @@
+package dynamodbutils
+
+import (
+	"testing"
+)
+
+func TestNextSequence(t *testing.T) {
+	key := Key{PKName: "State", PKValue: "SEQ", SKName: "Id", SKValue: 1}
+
+	first, err := NextSequence(tablename, key, 1)
+	check(err)
+
+	if first != 1 {
+		t.Errorf("first value should be 1 but was %d", first)
+	}
+
+	second, err := NextSequence(tablename, key, 5)
+	check(err)
+
+	if second != 6 {
+		t.Errorf("second value should be 6 but was %d", second)
+	}
+
+	_, err = NextSequence(tablename, key, 0)
+	if err == nil {
+		t.Error("err should be depicting that step must be greater than zero")
+	}
+}
+
+func TestSequenceAllocator(t *testing.T) {
+	key := Key{PKName: "State", PKValue: "SEQ", SKName: "Id", SKValue: 2}
+
+	allocator := NewSequenceAllocator(tablename, key, 10)
+
+	for expected := int64(1); expected <= 25; expected++ {
+		value, err := allocator.Next()
+		check(err)
+
+		if value != expected {
+			t.Errorf("value should be %d but was %d", expected, value)
+		}
+	}
+
+	// the allocator reserved three blocks of 10 values
+	current, err := NextSequence(tablename, key, 1)
+	check(err)
+
+	if current != 31 {
+		t.Errorf("the sequence should be at 31 but was at %d", current)
+	}
+}
@@ -0,0 +1,249 @@
+package dynamodbutils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// MaxItemSize is the maximum size of an item accepted by dynamodb, 400 KB.
+const MaxItemSize = 400 * 1024
+
+const (
+	maxAttributeNameLength    = 65535
+	maxKeyAttributeNameLength = 255
+	maxPartitionKeyLength     = 2048
+	maxSortKeyLength          = 1024
+	maxNumberDigits           = 38
+)
+
+// ItemSize computes the size of an item as billed by dynamodb: the lengths of the attribute names plus the
+// sizes of their values. The item must be in the dynamodb format, e.g. the output of
+// dynamodbattribute.MarshalMap.
+//
+// See https://docs.aws.amazon.com/amazondynamodb/latest/developerguide/CapacityUnitCalculations.html
+func ItemSize(item map[string]*dynamodb.AttributeValue) int {
+	return itemSize(item)
+}
+
+var itemValidation bool
+
+// SetItemValidation enables the validation of the items before they are written by PutItem, UpdateItem and
+// BulkWriter, so the items dynamodb would reject fail early with a descriptive error:
+//   - the item must not be larger than MaxItemSize. UpdateItem can only check the size of the key and of
+//     the attributes being set, since the rest of the item is not known.
+//   - the attribute names must not be empty nor longer than 64 KB, and the names of the key attributes
+//     must not be longer than 255 bytes.
+//   - the key attributes must not be empty, e.g. empty strings, which the aws sdk converts to NULL, and
+//     the strings and binaries must not be longer than 2048 bytes on the partition key and 1024 bytes on
+//     the sort key.
+//   - the numbers must have at most 38 significant digits and be between 1E-130 and 1E+126.
+//
+// PutItem and BulkWriter read the key schema of the tables with DescribeTable to check the key attributes.
+func SetItemValidation(enabled bool) {
+	itemValidation = enabled
+}
+
+// validateItem checks an item in the dynamodb format against the limits of dynamodb. The sort key name
+// may be empty. 'functionName' is used on the errors.
+func validateItem(functionName string, item map[string]*dynamodb.AttributeValue, pkName string, skName string) error {
+	if size := itemSize(item); size > MaxItemSize {
+		return fmt.Errorf("dynamodbutils.%s: the item has %d bytes, more than the limit of %d bytes", functionName, size, MaxItemSize)
+	}
+
+	keys := []struct {
+		name      string
+		maxLength int
+	}{{pkName, maxPartitionKeyLength}, {skName, maxSortKeyLength}}
+
+	for _, key := range keys {
+		if len(key.name) == 0 {
+			continue
+		}
+		if len(key.name) > maxKeyAttributeNameLength {
+			return fmt.Errorf("dynamodbutils.%s: the name of the key attribute '%.20s...' is longer than %d bytes", functionName, key.name, maxKeyAttributeNameLength)
+		}
+		if err := validateKeyValue(key.name, item[key.name], key.maxLength); err != nil {
+			return fmt.Errorf("dynamodbutils.%s: %s", functionName, err.Error())
+		}
+	}
+
+	for name, attribute := range item {
+		if err := validateAttribute(name, attribute); err != nil {
+			return fmt.Errorf("dynamodbutils.%s: %s", functionName, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func validateKeyValue(name string, attribute *dynamodb.AttributeValue, maxLength int) error {
+	switch {
+	case attribute == nil:
+		return fmt.Errorf("the key attribute '%s' is missing", name)
+	case attribute.NULL != nil:
+		return fmt.Errorf("the key attribute '%s' is empty", name)
+	case attribute.S != nil && len(*attribute.S) == 0, attribute.B != nil && len(attribute.B) == 0:
+		return fmt.Errorf("the key attribute '%s' is empty", name)
+	case attribute.S == nil && attribute.N == nil && attribute.B == nil:
+		return fmt.Errorf("the key attribute '%s' must be a string, a number or a binary", name)
+	case attribute.S != nil && len(*attribute.S) > maxLength, attribute.B != nil && len(attribute.B) > maxLength:
+		return fmt.Errorf("the key attribute '%s' is longer than %d bytes", name, maxLength)
+	}
+	return nil
+}
+
+// validateAttribute checks the name of an attribute and the numbers in its value, including the nested ones.
+func validateAttribute(path string, attribute *dynamodb.AttributeValue) error {
+	name := path
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		name = path[i+1:]
+	}
+
+	if len(name) == 0 {
+		return fmt.Errorf("the attribute '%s' has an empty name", path)
+	}
+	if len(name) > maxAttributeNameLength {
+		return fmt.Errorf("the name of the attribute '%.20s...' is longer than %d bytes", path, maxAttributeNameLength)
+	}
+
+	if attribute == nil {
+		return nil
+	}
+
+	numbers := attribute.NS
+	if attribute.N != nil {
+		numbers = append(numbers, attribute.N)
+	}
+	for _, n := range numbers {
+		if err := validateNumber(aws.StringValue(n)); err != nil {
+			return fmt.Errorf("the attribute '%s' has an invalid number: %s", path, err.Error())
+		}
+	}
+
+	for i, element := range attribute.L {
+		if err := validateAttribute(fmt.Sprintf("%s[%d]", path, i), element); err != nil {
+			return err
+		}
+	}
+
+	for elementName, element := range attribute.M {
+		if err := validateAttribute(path+"."+elementName, element); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateNumber checks the precision and the magnitude of a number.
+func validateNumber(n string) error {
+	value, err := strconv.ParseFloat(n, 64)
+	if err != nil && !strings.Contains(err.Error(), "value out of range") {
+		return fmt.Errorf("%s is not a number", n)
+	}
+
+	if digits := significantDigits(n); len(digits) > maxNumberDigits {
+		return fmt.Errorf("%s has %d significant digits, more than the limit of %d", n, len(digits), maxNumberDigits)
+	}
+
+	if value < 0 {
+		value = -value
+	}
+	// numbers too small for a float64 are parsed as 0
+	underflow := value == 0 && len(significantDigits(n)) > 0
+	if underflow || value != 0 && (value < 1e-130 || value >= 1e126) {
+		return fmt.Errorf("%s is out of the range from 1E-130 to 9.9999999999999999999999999999999999999E+125", n)
+	}
+
+	return nil
+}
+
+// itemSize computes the size of an item. See ItemSize.
+func itemSize(item map[string]*dynamodb.AttributeValue) int {
+	size := 0
+	for name, attribute := range item {
+		size += len(name) + attributeSize(attribute)
+	}
+	return size
+}
+
+// attributeSize computes the size of an attribute value.
+func attributeSize(attribute *dynamodb.AttributeValue) int {
+	if attribute == nil {
+		return 0
+	}
+
+	switch {
+	case attribute.S != nil:
+		return len(*attribute.S)
+	case attribute.N != nil:
+		return numberSize(*attribute.N)
+	case attribute.B != nil:
+		return len(attribute.B)
+	case attribute.BOOL != nil, attribute.NULL != nil:
+		return 1
+	case attribute.SS != nil:
+		size := 0
+		for _, s := range attribute.SS {
+			size += len(*s)
+		}
+		return size
+	case attribute.NS != nil:
+		size := 0
+		for _, n := range attribute.NS {
+			size += numberSize(*n)
+		}
+		return size
+	case attribute.BS != nil:
+		size := 0
+		for _, b := range attribute.BS {
+			size += len(b)
+		}
+		return size
+	case attribute.L != nil:
+		// lists and maps have 3 bytes of overhead, plus 1 byte per element
+		size := 3
+		for _, element := range attribute.L {
+			size += 1 + attributeSize(element)
+		}
+		return size
+	case attribute.M != nil:
+		size := 3
+		for name, element := range attribute.M {
+			size += 1 + len(name) + attributeSize(element)
+		}
+		return size
+	}
+
+	return 0
+}
+
+// numberSize computes the size of a number: 1 byte per two significant digits, plus 1 byte.
+func numberSize(n string) int {
+	digits := significantDigits(n)
+	return (len(digits)+1)/2 + 1
+}
+
+// significantDigits returns the digits of a number without its sign, exponent, decimal point and leading
+// and trailing zeroes.
+func significantDigits(n string) string {
+	n = strings.TrimLeft(n, "+-")
+	if i := strings.IndexAny(n, "eE"); i >= 0 {
+		n = n[:i]
+	}
+	n = strings.Replace(n, ".", "", 1)
+	return strings.Trim(n, "0")
+}
+
+// writeCapacityUnits computes the write capacity consumed by writing an item of the given size: one unit per KB.
+func writeCapacityUnits(size int) float64 {
+	units := (size + 1023) / 1024
+	if units < 1 {
+		units = 1
+	}
+	return float64(units)
+}
@@ -0,0 +1,82 @@
+package dynamodbutils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestItemSize(t *testing.T) {
+	item := map[string]*dynamodb.AttributeValue{
+		"Name":   {S: aws.String("Belo Horizonte")},          // 4 + 14
+		"Id":     {N: aws.String("12345")},                   // 2 + 4
+		"Active": {BOOL: aws.Bool(true)},                     // 6 + 1
+		"Tags":   {SS: aws.StringSlice([]string{"a", "bc"})}, // 4 + 3
+		"Address": {M: map[string]*dynamodb.AttributeValue{ // 7 + 3 + (1 + 4 + 2)
+			"City": {S: aws.String("BH")},
+		}},
+		"Phones": {L: []*dynamodb.AttributeValue{{S: aws.String("123")}}}, // 6 + 3 + (1 + 3)
+	}
+
+	if size := ItemSize(item); size != 18+6+7+7+17+13 {
+		t.Errorf("the size should be %d but was %d", 18+6+7+7+17+13, size)
+	}
+
+	for n, expected := range map[string]int{"0": 1, "1000": 2, "-12.3400": 3, "0.00123": 3, "1E+10": 2} {
+		if size := numberSize(n); size != expected {
+			t.Errorf("the size of %s should be %d but was %d", n, expected, size)
+		}
+	}
+
+	if units := writeCapacityUnits(1025); units != 2 {
+		t.Errorf("an item of 1025 bytes should consume 2 write units but consumed %f", units)
+	}
+}
+
+func TestValidateItem(t *testing.T) {
+	valid := map[string]*dynamodb.AttributeValue{
+		"State": {S: aws.String("MG")},
+		"Id":    {N: aws.String("1")},
+	}
+	if err := validateItem("PutItem", valid, "State", "Id"); err != nil {
+		t.Errorf("the item should be valid: %s", err)
+	}
+
+	invalid := map[string]map[string]*dynamodb.AttributeValue{
+		"more than the limit of 409600 bytes": {"State": {S: aws.String("MG")}, "Id": {N: aws.String("1")}, "Data": {S: aws.String(strings.Repeat("x", MaxItemSize))}},
+		"key attribute 'State' is empty":      {"State": {NULL: aws.Bool(true)}, "Id": {N: aws.String("1")}},
+		"key attribute 'Id' is missing":       {"State": {S: aws.String("MG")}},
+		"has an empty name":                   {"State": {S: aws.String("MG")}, "Id": {N: aws.String("1")}, "": {S: aws.String("x")}},
+		"significant digits":                  {"State": {S: aws.String("MG")}, "Id": {N: aws.String("1")}, "Big": {N: aws.String("1234567890123456789012345678901234567890")}},
+		"out of the range":                    {"State": {S: aws.String("MG")}, "Id": {N: aws.String("1")}, "List": {L: []*dynamodb.AttributeValue{{N: aws.String("1E-400")}}}},
+	}
+
+	for message, item := range invalid {
+		err := validateItem("PutItem", item, "State", "Id")
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("the error should contain '%s' but was %v", message, err)
+		}
+	}
+}
+
+func TestValidateKeyLengths(t *testing.T) {
+	item := map[string]*dynamodb.AttributeValue{
+		"State": {S: aws.String(strings.Repeat("x", 2048))},
+		"Name":  {S: aws.String(strings.Repeat("x", 1024))},
+	}
+	if err := validateItem("PutItem", item, "State", "Name"); err != nil {
+		t.Errorf("the keys are within their limits: %s", err)
+	}
+
+	item["Name"] = &dynamodb.AttributeValue{S: aws.String(strings.Repeat("x", 1025))}
+	if err := validateItem("PutItem", item, "State", "Name"); err == nil || !strings.Contains(err.Error(), "'Name' is longer than 1024 bytes") {
+		t.Errorf("the sort key should be limited to 1024 bytes but the error was %v", err)
+	}
+
+	item["State"] = &dynamodb.AttributeValue{S: aws.String(strings.Repeat("x", 2049))}
+	if err := validateItem("PutItem", item, "State", ""); err == nil || !strings.Contains(err.Error(), "'State' is longer than 2048 bytes") {
+		t.Errorf("the partition key should be limited to 2048 bytes but the error was %v", err)
+	}
+}
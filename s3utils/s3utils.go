@@ -74,6 +74,19 @@ func PutObject(bucketname string, key string, body string) (location string, err
 	return uploadOutput.Location, nil
 }
 
+// DeleteObject removes from a bucket the object identified by its key.
+// No error is returned if the object does not exist.
+func DeleteObject(bucketName string, key string) error {
+	svc := s3.New(sessionutils.Session)
+
+	_, err := svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	})
+
+	return err
+}
+
 func getObjectAsBuf(bucketName string, key string) (data *bytes.Buffer, err error) {
 	var S3Client *s3.S3 = s3.New(sessionutils.Session)
 
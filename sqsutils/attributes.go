@@ -0,0 +1,217 @@
+package sqsutils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// The data types of the message attributes. A custom type is one of them followed by a dot and a label,
+// e.g. "Number.float" or "Binary.gzip".
+const (
+	StringDataType = "String"
+	NumberDataType = "Number"
+	BinaryDataType = "Binary"
+	// StringArrayDataType is the type of the slices, encoded as JSON arrays, as in the attributes of SNS.
+	StringArrayDataType = "String.Array"
+)
+
+// maxMessageAttributes is the maximum number of attributes of a message.
+const maxMessageAttributes = 10
+
+// MessageAttribute is a message attribute with an explicit data type, used to send custom types.
+//
+// Example:
+//
+//	SendMessage(queueUrl, body, map[string]interface{}{
+//	    "price": MessageAttribute{DataType: "Number.float", Value: 9.99},
+//	})
+type MessageAttribute struct {
+	DataType string      // mandatory
+	Value    interface{} // mandatory
+}
+
+// encodeMessageAttributes converts the attributes of a message to the attribute values of SQS.
+// The values can be:
+//   - strings, sent as String.
+//   - ints, uints and floats of any size, sent as Number.
+//   - []byte, sent as Binary.
+//   - other slices and arrays, sent as String.Array.
+//   - pointers to the types above. The nil pointers, as the nil values, are skipped: the message is sent
+//     without the attribute, since SQS has no null attribute.
+//   - MessageAttribute, to send the value with a custom data type.
+//
+// The floats are sent in their shortest representation, e.g. "0.1" or "1e+21", and must be in the range of
+// the numbers of SQS: from 1e-128 to 1e+126, positive or negative.
+func encodeMessageAttributes(messageAttributes map[string]interface{}) (map[string]*sqs.MessageAttributeValue, error) {
+	if messageAttributes == nil {
+		return nil, nil
+	}
+
+	msgAttributeValueMap := make(map[string]*sqs.MessageAttributeValue, len(messageAttributes))
+
+	for key, value := range messageAttributes {
+		attributeValue, err := encodeMessageAttribute(value)
+		if err != nil {
+			return nil, fmt.Errorf("sqsutils: message attribute %s: %v", key, err)
+		}
+
+		if attributeValue != nil {
+			msgAttributeValueMap[key] = attributeValue
+		}
+	}
+
+	return msgAttributeValueMap, nil
+}
+
+// encodeMessageAttribute converts an attribute to the attribute value of SQS, or to nil for the nil values.
+func encodeMessageAttribute(value interface{}) (*sqs.MessageAttributeValue, error) {
+	if attribute, ok := value.(MessageAttribute); ok {
+		attributeValue, err := encodeMessageAttribute(attribute.Value)
+		if err != nil || attributeValue == nil {
+			return nil, err
+		}
+
+		if baseDataType(attribute.DataType) != baseDataType(aws.StringValue(attributeValue.DataType)) {
+			return nil, fmt.Errorf("a %T cannot be sent as %s", attribute.Value, attribute.DataType)
+		}
+
+		attributeValue.DataType = aws.String(attribute.DataType)
+		return attributeValue, nil
+	}
+
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return stringAttribute(StringDataType, v.String()), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return stringAttribute(NumberDataType, strconv.FormatInt(v.Int(), 10)), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return stringAttribute(NumberDataType, strconv.FormatUint(v.Uint(), 10)), nil
+
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) || (f != 0 && (math.Abs(f) < 1e-128 || math.Abs(f) > 1e126)) {
+			return nil, fmt.Errorf("the number %v is out of the range of SQS", f)
+		}
+		return stringAttribute(NumberDataType, strconv.FormatFloat(f, 'g', -1, v.Type().Bits())), nil
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			binary := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(binary), v)
+			return &sqs.MessageAttributeValue{
+				DataType:    aws.String(BinaryDataType),
+				BinaryValue: binary,
+			}, nil
+		}
+
+		encoded, err := json.Marshal(v.Interface())
+		if err != nil {
+			return nil, err
+		}
+		return stringAttribute(StringArrayDataType, string(encoded)), nil
+	}
+
+	return nil, fmt.Errorf("type %T is not supported", value)
+}
+
+func stringAttribute(dataType string, value string) *sqs.MessageAttributeValue {
+	return &sqs.MessageAttributeValue{
+		DataType:    aws.String(dataType),
+		StringValue: aws.String(value),
+	}
+}
+
+// DecodeMessageAttributes converts the attributes of a received message to Go values:
+//   - String: string.
+//   - Number: int64 if the number is an integer, float64 otherwise. The custom types "Number.float" and
+//     "Number.double" are always float64.
+//   - Binary: []byte.
+//   - String.Array: []interface{}, decoded from the JSON array.
+//   - the other custom types are decoded as their base type.
+//
+// Example:
+//
+//	attributes, err := DecodeMessageAttributes(message.MessageAttributes)
+func DecodeMessageAttributes(messageAttributes map[string]*sqs.MessageAttributeValue) (map[string]interface{}, error) {
+	decoded := make(map[string]interface{}, len(messageAttributes))
+
+	for key, attributeValue := range messageAttributes {
+		value, err := DecodeMessageAttribute(attributeValue)
+		if err != nil {
+			return nil, fmt.Errorf("sqsutils: message attribute %s: %v", key, err)
+		}
+
+		decoded[key] = value
+	}
+
+	return decoded, nil
+}
+
+// DecodeMessageAttribute converts an attribute of a received message to a Go value, as in DecodeMessageAttributes.
+// A nil attribute is an error.
+func DecodeMessageAttribute(attributeValue *sqs.MessageAttributeValue) (interface{}, error) {
+	if attributeValue == nil {
+		return nil, errors.New("the attribute is nil")
+	}
+
+	dataType := aws.StringValue(attributeValue.DataType)
+	stringValue := aws.StringValue(attributeValue.StringValue)
+
+	switch {
+	case dataType == StringArrayDataType:
+		values := []interface{}{}
+		if err := json.Unmarshal([]byte(stringValue), &values); err != nil {
+			return nil, err
+		}
+		return values, nil
+
+	case baseDataType(dataType) == StringDataType:
+		return stringValue, nil
+
+	case baseDataType(dataType) == NumberDataType:
+		switch strings.ToLower(strings.TrimPrefix(dataType, NumberDataType)) {
+		case ".float", ".double":
+			return strconv.ParseFloat(stringValue, 64)
+		}
+
+		if n, err := strconv.ParseInt(stringValue, 10, 64); err == nil {
+			return n, nil
+		}
+		return strconv.ParseFloat(stringValue, 64)
+
+	case baseDataType(dataType) == BinaryDataType:
+		return attributeValue.BinaryValue, nil
+	}
+
+	return nil, fmt.Errorf("data type %s is not supported", dataType)
+}
+
+// baseDataType returns the data type without its custom label.
+func baseDataType(dataType string) string {
+	if i := strings.Index(dataType, "."); i >= 0 {
+		return dataType[:i]
+	}
+	return dataType
+}
@@ -0,0 +1,66 @@
+package sqsutils
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+func TestSendMessageAndReadMessage(t *testing.T) {
+	queueUrl := createQueue("attributes", QueueAttributes{})
+	defer DeleteQueue(queueUrl)
+
+	var missing *string
+	check(SendMessage(queueUrl, "hello", map[string]interface{}{
+		"name":    "Maria",
+		"count":   42,
+		"ratio":   0.1,
+		"payload": []byte{1, 2, 3},
+		"tags":    []string{"a", "b"},
+		"price":   MessageAttribute{DataType: "Number.float", Value: 9.5},
+		"missing": missing,
+	}))
+
+	messages := readMessages(queueUrl, 1, 5*time.Second)
+	if len(messages) != 1 {
+		t.Fatalf("1 message should have been read but %d were", len(messages))
+	}
+
+	if body := aws.StringValue(messages[0].Body); body != "hello" {
+		t.Errorf("the body should be 'hello' but was '%s'", body)
+	}
+
+	attributes, err := DecodeMessageAttributes(messages[0].MessageAttributes)
+	check(err)
+
+	expected := map[string]interface{}{
+		"name":    "Maria",
+		"count":   int64(42),
+		"ratio":   0.1,
+		"payload": []byte{1, 2, 3},
+		"tags":    []interface{}{"a", "b"},
+		"price":   9.5,
+	}
+	if !reflect.DeepEqual(attributes, expected) {
+		t.Errorf("Expected: %v, Result: %v", expected, attributes)
+	}
+
+	check(DeleteMessage(queueUrl, aws.StringValue(messages[0].ReceiptHandle)))
+
+	if left := readMessages(queueUrl, 1, time.Second); len(left) != 0 {
+		t.Errorf("the message should have been deleted")
+	}
+}
+
+func TestDecodeMessageAttributeRejectsNil(t *testing.T) {
+	if _, err := DecodeMessageAttribute(nil); err == nil {
+		t.Error("a nil attribute should have been rejected")
+	}
+
+	if _, err := DecodeMessageAttributes(map[string]*sqs.MessageAttributeValue{"missing": nil}); err == nil {
+		t.Error("a nil attribute should have been rejected")
+	}
+}
@@ -0,0 +1,332 @@
+package sqsutils
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/AmeDigital/aws-utils-go/sessionutils"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+const (
+	// maxBatchEntries is the maximum number of entries of a SendMessageBatch or DeleteMessageBatch call.
+	maxBatchEntries = 10
+	// MaxMessageSize is the maximum size of a message, or of all the messages of a batch, in bytes: the body
+	// plus the names, types and values of the attributes.
+	MaxMessageSize = 256 * 1024
+	// maxBatchAttempts is how many times the failed entries of a batch are sent.
+	maxBatchAttempts = 3
+)
+
+// BatchMessage is a message sent with SendMessageBatch.
+//   - DelaySeconds: how long the message stays invisible after it is sent, from 0 to 900.
+//     Default: the delay of the queue.
+type BatchMessage struct {
+	Body              string                 // mandatory
+	MessageAttributes map[string]interface{} // optional
+	DelaySeconds      int64                  // optional
+}
+
+// SendBatchResult is the result of a message sent with SendMessageBatch. Error is nil when the message was
+// sent.
+type SendBatchResult struct {
+	MessageId string
+	Error     error
+}
+
+// SendMessageBatch sends many messages with SendMessageBatch calls of up to 10 messages and 256 KB each.
+// The entries that fail by a fault of SQS are sent again, up to 3 times.
+//
+// The results are returned in the order of the messages, and tell the id or the error of each message.
+//
+// Example:
+//
+//	results, err := SendMessageBatch(queueUrl, []BatchMessage{{Body: "a"}, {Body: "b"}})
+//
+// The errors returned are:
+//   - BatchEntryFailedException: some of the messages were not sent; see the errors of the results.
+//     Note: use 'err.Error() == "BatchEntryFailedException"' to identify this error.
+//
+// The errors of the results are:
+//   - MessageTooLongException: the message is larger than MaxMessageSize. It is not sent.
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/sqs/#SQS.SendMessageBatch
+func SendMessageBatch(queueUrl string, messages []BatchMessage) ([]SendBatchResult, error) {
+	results := make([]SendBatchResult, len(messages))
+	entries := make([]*sqs.SendMessageBatchRequestEntry, len(messages))
+
+	for i, message := range messages {
+		entry, err := newBatchEntry(i, message.Body, message.MessageAttributes)
+		if err != nil {
+			results[i].Error = err
+			continue
+		}
+		if message.DelaySeconds > 0 {
+			entry.DelaySeconds = aws.Int64(message.DelaySeconds)
+		}
+
+		entries[i] = entry
+	}
+
+	return sendBatchEntries(queueUrl, entries, results)
+}
+
+// newBatchEntry creates the entry of the i-th message of a batch.
+func newBatchEntry(i int, body string, messageAttributes map[string]interface{}) (*sqs.SendMessageBatchRequestEntry, error) {
+	attributes, err := encodeMessageAttributes(messageAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	body, attributes, err = offloadBody(body, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	if messageSize(body, attributes) > MaxMessageSize {
+		return nil, errors.New("MessageTooLongException")
+	}
+
+	return &sqs.SendMessageBatchRequestEntry{
+		Id:                aws.String(strconv.Itoa(i)),
+		MessageBody:       aws.String(body),
+		MessageAttributes: attributes,
+	}, nil
+}
+
+// sendBatchEntries sends the entries in chunks, in order, skipping the nil entries, whose errors are
+// already in the results.
+//
+// On FIFO queues, once an entry fails the later entries of its group are not sent, failing with
+// PreviousMessageFailedException, and the entries retried are sent in their order. A failed entry is
+// not retried when a later entry of its group was sent in the same call, since it would be delivered
+// after it.
+func sendBatchEntries(queueUrl string, entries []*sqs.SendMessageBatchRequestEntry, results []SendBatchResult) ([]SendBatchResult, error) {
+	sizes := make([]int, len(entries))
+	for i, entry := range entries {
+		if entry != nil {
+			sizes[i] = messageSize(aws.StringValue(entry.MessageBody), entry.MessageAttributes)
+		}
+	}
+
+	group := func(i int) string { return aws.StringValue(entries[i].MessageGroupId) }
+
+	// failedGroups holds the groups of FIFO queues having an entry that was not sent
+	failedGroups := make(map[string]bool)
+
+	SQSclient := sqs.New(sessionutils.Session)
+
+	for _, chunk := range batchChunks(sizes, func(i int) bool { return entries[i] != nil }) {
+		pending := []int{}
+		for _, i := range chunk {
+			if failedGroups[group(i)] {
+				results[i].Error = errors.New("PreviousMessageFailedException")
+				continue
+			}
+			pending = append(pending, i)
+		}
+
+		for attempt := 1; len(pending) > 0; attempt++ {
+			batch := make([]*sqs.SendMessageBatchRequestEntry, len(pending))
+			for j, i := range pending {
+				batch[j] = entries[i]
+			}
+
+			output, err := SQSclient.SendMessageBatch(&sqs.SendMessageBatchInput{
+				QueueUrl: aws.String(queueUrl),
+				Entries:  batch,
+			})
+			if err != nil {
+				for _, i := range pending {
+					results[i].Error = err
+				}
+				break
+			}
+
+			sent := make(map[int]bool, len(output.Successful))
+			for _, successful := range output.Successful {
+				i, _ := strconv.Atoi(aws.StringValue(successful.Id))
+				results[i] = SendBatchResult{MessageId: aws.StringValue(successful.MessageId)}
+				sent[i] = true
+			}
+
+			retry := failedEntries(output.Failed, attempt, func(i int, err error) { results[i].Error = err })
+
+			pending = []int{}
+			for _, i := range retry {
+				if !sentLater(i, sent, group) {
+					pending = append(pending, i)
+				}
+			}
+			sort.Ints(pending)
+		}
+
+		for _, i := range chunk {
+			if results[i].Error != nil && len(group(i)) > 0 {
+				failedGroups[group(i)] = true
+			}
+		}
+	}
+
+	failed := false
+	for i, result := range results {
+		if result.Error != nil {
+			failed = true
+			if entries[i] != nil {
+				deleteOffloadedPointer(&sqs.SendMessageInput{MessageBody: entries[i].MessageBody, MessageAttributes: entries[i].MessageAttributes})
+			}
+		}
+	}
+
+	if failed {
+		return results, errors.New("BatchEntryFailedException")
+	}
+
+	return results, nil
+}
+
+// sentLater tells whether an entry of the same FIFO group as the i-th one, and after it, was sent.
+func sentLater(i int, sent map[int]bool, group func(i int) string) bool {
+	if len(group(i)) == 0 {
+		return false
+	}
+	for j := range sent {
+		if j > i && group(j) == group(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteMessageBatch deletes many messages with DeleteMessageBatch calls of up to 10 messages.
+// The entries that fail by a fault of SQS are deleted again, up to 3 times.
+//
+// The errors are returned in the order of the receipt handles; the error of a message deleted is nil.
+// The bodies of the messages offloaded to s3 are deleted from s3; see the OnDeleteError of S3OffloadConfig.
+//
+// The errors returned are:
+//   - BatchEntryFailedException: some of the messages were not deleted; see the errors of the results.
+//     Note: use 'err.Error() == "BatchEntryFailedException"' to identify this error.
+//
+// The errors of the results are:
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/sqs/#SQS.DeleteMessageBatch
+func DeleteMessageBatch(queueUrl string, receiptHandles []string) ([]error, error) {
+	results := make([]error, len(receiptHandles))
+
+	SQSclient := sqs.New(sessionutils.Session)
+
+	for start := 0; start < len(receiptHandles); start += maxBatchEntries {
+		end := start + maxBatchEntries
+		if end > len(receiptHandles) {
+			end = len(receiptHandles)
+		}
+
+		pending := make([]int, 0, end-start)
+		for i := start; i < end; i++ {
+			pending = append(pending, i)
+		}
+
+		for attempt := 1; len(pending) > 0; attempt++ {
+			batch := make([]*sqs.DeleteMessageBatchRequestEntry, len(pending))
+			for j, i := range pending {
+				batch[j] = &sqs.DeleteMessageBatchRequestEntry{
+					Id:            aws.String(strconv.Itoa(i)),
+					ReceiptHandle: aws.String(sqsReceiptHandle(receiptHandles[i])),
+				}
+			}
+
+			output, err := SQSclient.DeleteMessageBatch(&sqs.DeleteMessageBatchInput{
+				QueueUrl: aws.String(queueUrl),
+				Entries:  batch,
+			})
+			if err != nil {
+				for _, i := range pending {
+					results[i] = err
+				}
+				break
+			}
+
+			for _, successful := range output.Successful {
+				i, _ := strconv.Atoi(aws.StringValue(successful.Id))
+				results[i] = nil
+				deleteOffloadedBody(receiptHandles[i])
+			}
+
+			pending = failedEntries(output.Failed, attempt, func(i int, err error) { results[i] = err })
+		}
+	}
+
+	for _, err := range results {
+		if err != nil {
+			return results, errors.New("BatchEntryFailedException")
+		}
+	}
+
+	return results, nil
+}
+
+// failedEntries records the errors of the failed entries of a batch and returns the indexes of the ones
+// to be sent again: the entries that did not fail by a fault of the sender, while there are attempts left.
+func failedEntries(failed []*sqs.BatchResultErrorEntry, attempt int, setError func(i int, err error)) []int {
+	retry := []int{}
+
+	for _, entry := range failed {
+		i, _ := strconv.Atoi(aws.StringValue(entry.Id))
+		setError(i, awserr.New(aws.StringValue(entry.Code), aws.StringValue(entry.Message), nil))
+
+		if !aws.BoolValue(entry.SenderFault) && attempt < maxBatchAttempts {
+			retry = append(retry, i)
+		}
+	}
+
+	if len(retry) > 0 {
+		time.Sleep(time.Duration(100<<uint(attempt-1)) * time.Millisecond)
+	}
+
+	return retry
+}
+
+// batchChunks splits the indexes of the entries accepted by 'include' into chunks of up to 10 entries and
+// MaxMessageSize bytes.
+func batchChunks(sizes []int, include func(i int) bool) [][]int {
+	chunks := [][]int{}
+	chunk := []int{}
+	chunkSize := 0
+
+	for i, size := range sizes {
+		if !include(i) {
+			continue
+		}
+
+		if len(chunk) == maxBatchEntries || chunkSize+size > MaxMessageSize {
+			chunks = append(chunks, chunk)
+			chunk, chunkSize = []int{}, 0
+		}
+
+		chunk = append(chunk, i)
+		chunkSize += size
+	}
+
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+// messageSize returns the size of a message as counted by SQS: the body plus the names, data types and
+// values of the attributes.
+func messageSize(body string, attributes map[string]*sqs.MessageAttributeValue) int {
+	size := len(body)
+
+	for name, attribute := range attributes {
+		size += len(name) + len(aws.StringValue(attribute.DataType)) +
+			len(aws.StringValue(attribute.StringValue)) + len(attribute.BinaryValue)
+	}
+
+	return size
+}
@@ -0,0 +1,87 @@
+package sqsutils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+func TestSendMessageBatchAndDeleteMessageBatch(t *testing.T) {
+	queueUrl := createQueue("batch", QueueAttributes{})
+	defer DeleteQueue(queueUrl)
+
+	messages := []BatchMessage{}
+	for _, body := range []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11"} {
+		messages = append(messages, BatchMessage{Body: body})
+	}
+	// a message too long fails alone, the others are sent
+	messages[4].Body = strings.Repeat("x", MaxMessageSize+1)
+
+	results, err := SendMessageBatch(queueUrl, messages)
+	if err == nil || err.Error() != "BatchEntryFailedException" {
+		t.Errorf("the error should be BatchEntryFailedException but was %v", err)
+	}
+
+	for i, result := range results {
+		if i == 4 {
+			if result.Error == nil || result.Error.Error() != "MessageTooLongException" {
+				t.Errorf("the message 4 should have failed with MessageTooLongException but got %v", result.Error)
+			}
+		} else if result.Error != nil || len(result.MessageId) == 0 {
+			t.Errorf("the message %d should have been sent but got %+v", i, result)
+		}
+	}
+
+	received := readMessages(queueUrl, 10, 5*time.Second)
+	if len(received) != 10 {
+		t.Fatalf("10 messages should have been read but %d were", len(received))
+	}
+
+	receiptHandles := []string{"invalid-receipt-handle"}
+	for _, message := range received {
+		receiptHandles = append(receiptHandles, aws.StringValue(message.ReceiptHandle))
+	}
+
+	errs, err := DeleteMessageBatch(queueUrl, receiptHandles)
+	if err == nil || err.Error() != "BatchEntryFailedException" {
+		t.Errorf("the error should be BatchEntryFailedException but was %v", err)
+	}
+	if errs[0] == nil {
+		t.Error("the invalid receipt handle should have failed")
+	}
+	for i, err := range errs[1:] {
+		if err != nil {
+			t.Errorf("the message %d should have been deleted but got %v", i+1, err)
+		}
+	}
+
+	if left := readMessages(queueUrl, 1, time.Second); len(left) != 0 {
+		t.Errorf("the messages should have been deleted but %d are left", len(left))
+	}
+}
+
+func TestFailedEntries(t *testing.T) {
+	failed := []*sqs.BatchResultErrorEntry{
+		{Id: aws.String("0"), Code: aws.String("InternalError"), SenderFault: aws.Bool(false)},
+		{Id: aws.String("2"), Code: aws.String("InvalidParameterValue"), SenderFault: aws.Bool(true)},
+	}
+
+	errs := make([]error, 3)
+	setError := func(i int, err error) { errs[i] = err }
+
+	// the faults of SQS are retried while there are attempts left
+	if retry := failedEntries(failed, 1, setError); !reflect.DeepEqual(retry, []int{0}) {
+		t.Errorf("only the entry 0 should be retried but got %v", retry)
+	}
+	if errs[0] == nil || errs[1] != nil || errs[2] == nil {
+		t.Errorf("the errors of the entries 0 and 2 should have been set but got %v", errs)
+	}
+
+	if retry := failedEntries(failed, maxBatchAttempts, setError); len(retry) != 0 {
+		t.Errorf("no entry should be retried after the last attempt but got %v", retry)
+	}
+}
@@ -0,0 +1,268 @@
+package sqsutils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AmeDigital/aws-utils-go/sessionutils"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// Handler processes a message received from a queue. The message is deleted from the queue when the
+// handler returns nil; otherwise it is left on the queue to be received again after its visibility timeout.
+type Handler func(ctx context.Context, message *sqs.Message) error
+
+// ConsumerOptions holds the settings of a Consumer.
+//   - Workers: the number of messages processed at the same time. Default 1.
+//   - MaxNumberOfMessages: the number of messages read by each ReceiveMessage call, from 1 to 10. Default 10.
+//   - WaitTimeSeconds: how long each ReceiveMessage call waits for messages to arrive (long polling),
+//     from 0 to 20 seconds. Default 20.
+//   - VisibilityTimeout: the visibility timeout of the messages received, in seconds. Default: the queue's.
+//   - OnError: called with the errors of the consumer: the errors of ReceiveMessage (with a nil message),
+//     the errors returned by the handler or by DeleteMessage (with the message being processed), and the
+//     errors of reading the bodies offloaded to s3 (with the message, which is not processed).
+//     By default the errors are printed.
+//   - Heartbeat: when set, the visibility timeout of the messages is extended while they are processed,
+//     as in ProcessWithHeartbeat. Its errors are also passed to OnError.
+//   - Fifo: process the messages of the same group of a FIFO queue in order, one at a time, while the
+//     groups are processed in parallel. When a message fails the next messages of its group received with
+//     it are not processed, and are received again after it.
+//   - UnwrapSNS: pass to the handler the body and the attributes published to SNS, when the queue is
+//     subscribed to a topic without raw message delivery. The envelopes that cannot be unwrapped are not
+//     passed to the handler: their errors go to OnError and they are left on the queue. To send them to a
+//     PoisonSink use the option UnwrapSNS of the JSONHandler instead. See UnwrapSNSNotification and
+//     SNSNotificationFromContext.
+type ConsumerOptions struct {
+	Workers             int                                   // optional
+	MaxNumberOfMessages int64                                 // optional
+	WaitTimeSeconds     int64                                 // optional
+	VisibilityTimeout   int64                                 // optional
+	OnError             func(err error, message *sqs.Message) // optional
+	Heartbeat           *HeartbeatOptions                     // optional
+	Fifo                bool                                  // optional
+	UnwrapSNS           bool                                  // optional
+}
+
+// Consumer reads the messages of a queue with long polling and processes them with a Handler on a pool of
+// goroutines.
+//
+// Example:
+//
+//	consumer := NewConsumer(queueUrl, func(ctx context.Context, message *sqs.Message) error {
+//	    return process(*message.Body)
+//	}, ConsumerOptions{Workers: 5})
+//
+// err := consumer.Run(ctx) // returns after ctx is cancelled and the messages in progress are processed
+type Consumer struct {
+	queueUrl string
+	handler  Handler
+	opts     ConsumerOptions
+}
+
+// receiveErrorBackoff is the time waited before receiving messages again after an error.
+var receiveErrorBackoff = time.Second
+
+// NewConsumer creates a Consumer of the given queue.
+func NewConsumer(queueUrl string, handler Handler, opts ConsumerOptions) *Consumer {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.MaxNumberOfMessages <= 0 || opts.MaxNumberOfMessages > 10 {
+		opts.MaxNumberOfMessages = 10
+	}
+	if opts.WaitTimeSeconds <= 0 || opts.WaitTimeSeconds > 20 {
+		opts.WaitTimeSeconds = 20
+	}
+	if opts.OnError == nil {
+		opts.OnError = func(err error, message *sqs.Message) {
+			if message != nil {
+				fmt.Printf("Error processing the message %s: %v\n", aws.StringValue(message.MessageId), err)
+			} else {
+				fmt.Println("Error receiving messages:", err)
+			}
+		}
+	}
+
+	return &Consumer{queueUrl: queueUrl, handler: handler, opts: opts}
+}
+
+// Run receives and processes the messages of the queue until the context is cancelled. Then it stops
+// receiving messages, waits for the messages being processed and returns the error of the context.
+// The messages received but not yet processed are made visible again on the queue, so other consumers can
+// receive them right away.
+//
+// The handlers are called with a context that is not cancelled with Run's, so the messages in progress
+// are processed to the end.
+func (c *Consumer) Run(ctx context.Context) error {
+	// each unit is processed in order by a worker: a message, or the messages of a group of a FIFO queue.
+	// A FIFO queue does not deliver the next messages of a group while the ones received are not deleted,
+	// so the units of the same group are never processed at the same time.
+	units := make(chan []*sqs.Message)
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for unit := range units {
+				c.processUnit(unit)
+			}
+		}()
+	}
+
+	defer wg.Wait()
+	defer close(units)
+
+	for {
+		received, err := receiveMessages(ctx, c.queueUrl, receiveOptions{
+			MaxNumberOfMessages: c.opts.MaxNumberOfMessages,
+			WaitTimeSeconds:     c.opts.WaitTimeSeconds,
+			VisibilityTimeout:   c.opts.VisibilityTimeout,
+			OnLoadError:         c.opts.OnError,
+		})
+
+		if ctx.Err() != nil {
+			c.release(received)
+			return ctx.Err()
+		}
+
+		if err != nil {
+			c.opts.OnError(err, nil)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(receiveErrorBackoff):
+			}
+			continue
+		}
+
+		grouped := groupMessages(received, c.opts.Fifo)
+		for i, unit := range grouped {
+			select {
+			case units <- unit:
+			case <-ctx.Done():
+				for _, rest := range grouped[i:] {
+					c.release(rest)
+				}
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// processUnit processes the messages of a unit in order, until one of them fails. The remaining messages
+// are made visible again.
+func (c *Consumer) processUnit(unit []*sqs.Message) {
+	for i, message := range unit {
+		if !c.process(message) {
+			c.release(unit[i+1:])
+			return
+		}
+	}
+}
+
+// process runs the handler on a message and deletes it if it succeeds. It tells whether the handler succeeded.
+func (c *Consumer) process(message *sqs.Message) bool {
+	handler := c.handler
+	if c.opts.Heartbeat != nil {
+		opts := *c.opts.Heartbeat
+		if opts.OnError == nil {
+			opts.OnError = func(err error) { c.opts.OnError(err, message) }
+		}
+		handler = func(ctx context.Context, message *sqs.Message) error {
+			return ProcessWithHeartbeat(ctx, c.queueUrl, message, opts, c.handler)
+		}
+	}
+
+	ctx := context.Background()
+	if c.opts.UnwrapSNS {
+		var err error
+		if ctx, message, err = unwrapSNSNotification(ctx, message); err != nil {
+			// the message is not handled and goes to the dead-letter queue after its retries
+			c.opts.OnError(err, message)
+			return false
+		}
+	}
+
+	if err := callHandler(ctx, handler, message); err != nil {
+		c.opts.OnError(err, message)
+		return false
+	}
+
+	if err := DeleteMessage(c.queueUrl, aws.StringValue(message.ReceiptHandle)); err != nil {
+		c.opts.OnError(err, message)
+	}
+
+	return true
+}
+
+// callHandler runs the handler, converting its panics into errors.
+func callHandler(ctx context.Context, handler Handler, message *sqs.Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("sqsutils: the handler panicked: %v", r)
+		}
+	}()
+
+	return handler(ctx, message)
+}
+
+// release makes the messages visible again on the queue.
+func (c *Consumer) release(messages []*sqs.Message) {
+	if len(messages) == 0 {
+		return
+	}
+
+	SQSclient := sqs.New(sessionutils.Session)
+
+	for _, message := range messages {
+		SQSclient.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(c.queueUrl),
+			ReceiptHandle:     aws.String(sqsReceiptHandle(aws.StringValue(message.ReceiptHandle))),
+			VisibilityTimeout: aws.Int64(0),
+		})
+	}
+}
+
+// receiveOptions holds the settings of a ReceiveMessage call.
+type receiveOptions struct {
+	MaxNumberOfMessages int64
+	WaitTimeSeconds     int64
+	VisibilityTimeout   int64
+	OnLoadError         func(err error, message *sqs.Message)
+}
+
+// receiveMessages reads messages from a queue. All the message attributes are read, and the SentTimestamp
+// and MessageGroupId of the messages. The bodies of the messages offloaded to s3 are read from s3; the
+// messages whose body cannot be read are passed to OnLoadError and not returned.
+func receiveMessages(ctx context.Context, queueUrl string, opts receiveOptions) ([]*sqs.Message, error) {
+	SQSclient := sqs.New(sessionutils.Session)
+
+	input := &sqs.ReceiveMessageInput{
+		AttributeNames: []*string{
+			aws.String(sqs.MessageSystemAttributeNameSentTimestamp),
+			aws.String(sqs.MessageSystemAttributeNameMessageGroupId),
+		},
+		MessageAttributeNames: []*string{
+			aws.String(sqs.QueueAttributeNameAll),
+		},
+		QueueUrl:            aws.String(queueUrl),
+		MaxNumberOfMessages: aws.Int64(opts.MaxNumberOfMessages),
+		WaitTimeSeconds:     aws.Int64(opts.WaitTimeSeconds),
+	}
+
+	if opts.VisibilityTimeout > 0 {
+		input.VisibilityTimeout = aws.Int64(opts.VisibilityTimeout)
+	}
+
+	result, err := SQSclient.ReceiveMessageWithContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadOffloadedBodies(result.Messages, opts.OnLoadError), nil
+}
@@ -0,0 +1,64 @@
+package sqsutils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+func TestConsumerDrainsAndReleasesOnCancel(t *testing.T) {
+	// the messages not released would stay invisible for a minute
+	queueUrl := createQueue("consumer-drain", QueueAttributes{VisibilityTimeout: 60})
+	defer DeleteQueue(queueUrl)
+
+	for _, body := range []string{"1", "2", "3"} {
+		check(SendMessage(queueUrl, body, nil))
+	}
+
+	started := make(chan string, 3)
+	proceed := make(chan struct{})
+
+	consumer := NewConsumer(queueUrl, func(ctx context.Context, message *sqs.Message) error {
+		started <- aws.StringValue(message.Body)
+		<-proceed
+		return nil
+	}, ConsumerOptions{Workers: 1, WaitTimeSeconds: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- consumer.Run(ctx) }()
+
+	var processed string
+	select {
+	case processed = <-started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no message was processed")
+	}
+
+	// Run waits for the message in progress
+	cancel()
+	select {
+	case <-stopped:
+		t.Fatal("Run returned before the message in progress was processed")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	close(proceed)
+	if err := <-stopped; err != context.Canceled {
+		t.Errorf("Run should return context.Canceled but returned %v", err)
+	}
+
+	// the message processed was deleted and the others are visible again right away
+	messages := readMessages(queueUrl, 2, 5*time.Second)
+
+	bodies := map[string]bool{}
+	for _, message := range messages {
+		bodies[aws.StringValue(message.Body)] = true
+	}
+	if len(bodies) != 2 || bodies[processed] {
+		t.Errorf("the messages other than %s should have been released, but %v were read", processed, bodies)
+	}
+}
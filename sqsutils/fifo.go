@@ -0,0 +1,156 @@
+package sqsutils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// FifoMessage is a message sent to a FIFO queue.
+//   - MessageGroupId: the messages of the same group are delivered in the order they were sent, one group
+//     at a time; the messages of different groups can be processed in parallel.
+//   - MessageDeduplicationId: the messages sent with the same id within 5 minutes are delivered once.
+//     Mandatory unless the queue has content-based deduplication enabled or ContentBasedDeduplication is set.
+//   - ContentBasedDeduplication: when MessageDeduplicationId is empty, use the SHA-256 of the body as the
+//     deduplication id, as SQS does on the queues with content-based deduplication enabled. The attributes
+//     of the message are not part of the hash.
+type FifoMessage struct {
+	Body                      string                 // mandatory
+	MessageAttributes         map[string]interface{} // optional
+	MessageGroupId            string                 // mandatory
+	MessageDeduplicationId    string                 // optional
+	ContentBasedDeduplication bool                   // optional
+}
+
+// SendFifoMessage sends a message to a FIFO queue.
+//
+// Example:
+//
+//	err := SendFifoMessage(queueUrl, FifoMessage{
+//	    Body:                      body,
+//	    MessageGroupId:            order.CustomerId,
+//	    ContentBasedDeduplication: true,
+//	})
+//
+// The errors returned are:
+//   - MissingParameter: MessageGroupId is empty.
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/sqs/#SQS.SendMessage
+func SendFifoMessage(queueUrl string, message FifoMessage) error {
+	if len(message.MessageGroupId) == 0 {
+		return errors.New("MissingParameter")
+	}
+
+	attributes, err := encodeMessageAttributes(message.MessageAttributes)
+	if err != nil {
+		return err
+	}
+
+	return sendMessage(context.Background(), &sqs.SendMessageInput{
+		QueueUrl:               aws.String(queueUrl),
+		MessageBody:            aws.String(message.Body),
+		MessageAttributes:      attributes,
+		MessageGroupId:         aws.String(message.MessageGroupId),
+		MessageDeduplicationId: deduplicationId(message),
+	})
+}
+
+// SendFifoMessageBatch sends many messages to a FIFO queue, as SendMessageBatch does. The messages are sent
+// in order and the order of each group is kept: when a message fails, the later messages of its group are
+// not sent, and the messages sent again after failing by a fault of SQS are sent in their order. A failed
+// message is not sent again if a later message of its group was already accepted in the same call.
+//
+// The errors returned are:
+//   - BatchEntryFailedException: some of the messages were not sent; see the errors of the results.
+//     Note: use 'err.Error() == "BatchEntryFailedException"' to identify this error.
+//
+// The errors of the results are:
+//   - MissingParameter: MessageGroupId is empty. The message is not sent.
+//   - MessageTooLongException: the message is larger than MaxMessageSize. It is not sent.
+//   - PreviousMessageFailedException: an earlier message of the same group was not sent, so this one was
+//     not sent either.
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/sqs/#SQS.SendMessageBatch
+func SendFifoMessageBatch(queueUrl string, messages []FifoMessage) ([]SendBatchResult, error) {
+	results := make([]SendBatchResult, len(messages))
+	entries := make([]*sqs.SendMessageBatchRequestEntry, len(messages))
+
+	// the groups having a message that cannot be sent
+	failedGroups := make(map[string]bool)
+
+	for i, message := range messages {
+		if len(message.MessageGroupId) == 0 {
+			results[i].Error = errors.New("MissingParameter")
+			continue
+		}
+
+		if failedGroups[message.MessageGroupId] {
+			results[i].Error = errors.New("PreviousMessageFailedException")
+			continue
+		}
+
+		entry, err := newBatchEntry(i, message.Body, message.MessageAttributes)
+		if err != nil {
+			results[i].Error = err
+			failedGroups[message.MessageGroupId] = true
+			continue
+		}
+		entry.MessageGroupId = aws.String(message.MessageGroupId)
+		entry.MessageDeduplicationId = deduplicationId(message)
+
+		entries[i] = entry
+	}
+
+	return sendBatchEntries(queueUrl, entries, results)
+}
+
+// deduplicationId returns the deduplication id of a message, or nil if it has none.
+func deduplicationId(message FifoMessage) *string {
+	if len(message.MessageDeduplicationId) > 0 {
+		return aws.String(message.MessageDeduplicationId)
+	}
+
+	if message.ContentBasedDeduplication {
+		hash := sha256.Sum256([]byte(message.Body))
+		return aws.String(hex.EncodeToString(hash[:]))
+	}
+
+	return nil
+}
+
+// messageGroupId returns the group of a message received from a FIFO queue, or "" for the other queues.
+func messageGroupId(message *sqs.Message) string {
+	return aws.StringValue(message.Attributes[sqs.MessageSystemAttributeNameMessageGroupId])
+}
+
+// groupMessages splits the messages received into the units processed by the workers of a Consumer.
+// Without 'fifo' each message is a unit; with it the messages of the same group are a unit, in the order
+// they were received, and the units are in the order of the first message of each group.
+func groupMessages(messages []*sqs.Message, fifo bool) [][]*sqs.Message {
+	units := make([][]*sqs.Message, 0, len(messages))
+
+	if !fifo {
+		for _, message := range messages {
+			units = append(units, []*sqs.Message{message})
+		}
+		return units
+	}
+
+	unitByGroup := make(map[string]int)
+	for _, message := range messages {
+		group := messageGroupId(message)
+
+		i, ok := unitByGroup[group]
+		if !ok {
+			i = len(units)
+			unitByGroup[group] = i
+			units = append(units, nil)
+		}
+
+		units[i] = append(units[i], message)
+	}
+
+	return units
+}
@@ -0,0 +1,97 @@
+package sqsutils
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+func TestSendFifoMessageBatchStopsFailedGroups(t *testing.T) {
+	queueUrl := createQueue("batch-groups.fifo", QueueAttributes{FifoQueue: true, ContentBasedDeduplication: true})
+	defer DeleteQueue(queueUrl)
+
+	results, err := SendFifoMessageBatch(queueUrl, []FifoMessage{
+		{Body: "a-1", MessageGroupId: "a"},
+		{Body: strings.Repeat("x", MaxMessageSize+1), MessageGroupId: "b"},
+		{Body: "b-2", MessageGroupId: "b"},
+		{Body: "a-2", MessageGroupId: "a"},
+		{Body: "without group"},
+	})
+	if err == nil || err.Error() != "BatchEntryFailedException" {
+		t.Errorf("the error should be BatchEntryFailedException but was %v", err)
+	}
+
+	expected := []string{"", "MessageTooLongException", "PreviousMessageFailedException", "", "MissingParameter"}
+	for i, result := range results {
+		message := ""
+		if result.Error != nil {
+			message = result.Error.Error()
+		}
+		if message != expected[i] {
+			t.Errorf("the error of the message %d should be '%s' but was '%s'", i, expected[i], message)
+		}
+	}
+
+	bodies := []string{}
+	for _, message := range readMessages(queueUrl, 2, 5*time.Second) {
+		bodies = append(bodies, aws.StringValue(message.Body))
+	}
+	if !reflect.DeepEqual(bodies, []string{"a-1", "a-2"}) {
+		t.Errorf("only the messages of the group a should have been sent, but %v were read", bodies)
+	}
+}
+
+func TestConsumerKeepsTheOrderOfFifoGroups(t *testing.T) {
+	queueUrl := createQueue("consumer-groups.fifo", QueueAttributes{FifoQueue: true, ContentBasedDeduplication: true, VisibilityTimeout: 1})
+	defer DeleteQueue(queueUrl)
+
+	messages := []FifoMessage{}
+	for i := 1; i <= 5; i++ {
+		for _, group := range []string{"a", "b"} {
+			messages = append(messages, FifoMessage{Body: fmt.Sprintf("%s-%d", group, i), MessageGroupId: group})
+		}
+	}
+	_, err := SendFifoMessageBatch(queueUrl, messages)
+	check(err)
+
+	var mutex sync.Mutex
+	processed := map[string][]string{}
+	failed := false
+
+	consumer := NewConsumer(queueUrl, func(ctx context.Context, message *sqs.Message) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		body := aws.StringValue(message.Body)
+		// the first attempt of b-2 fails: the next messages of the group wait for it
+		if body == "b-2" && !failed {
+			failed = true
+			return fmt.Errorf("failing %s once", body)
+		}
+
+		group := messageGroupId(message)
+		processed[group] = append(processed[group], body)
+		return nil
+	}, ConsumerOptions{Workers: 4, WaitTimeSeconds: 1, Fifo: true, OnError: func(err error, message *sqs.Message) {}})
+
+	runConsumer(consumer, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(processed["a"])+len(processed["b"]) == 10
+	})
+
+	expected := map[string][]string{
+		"a": {"a-1", "a-2", "a-3", "a-4", "a-5"},
+		"b": {"b-1", "b-2", "b-3", "b-4", "b-5"},
+	}
+	if !reflect.DeepEqual(processed, expected) {
+		t.Errorf("Expected: %v, Result: %v", expected, processed)
+	}
+}
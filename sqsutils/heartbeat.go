@@ -0,0 +1,117 @@
+package sqsutils
+
+import (
+	"context"
+	"time"
+
+	"github.com/AmeDigital/aws-utils-go/sessionutils"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// HeartbeatOptions holds the settings of the visibility heartbeat of a message.
+//   - VisibilityTimeout: the visibility timeout set by each heartbeat, in seconds. The first heartbeat is
+//     sent when the handler starts and the next ones every VisibilityTimeout/2 seconds. Default 30.
+//   - MaxExtension: the maximum time the message is kept invisible, counted from the start of the handler,
+//     not from the reception of the message. After it the heartbeats stop and the message becomes visible
+//     again. Default 12h, the limit of SQS, which counts it from the reception of the message instead: when
+//     the message waited before the handler started, SQS rejects the last heartbeats, whose errors are
+//     passed to OnError.
+//   - OnError: called with the errors of ChangeMessageVisibility. The heartbeats go on after an error.
+type HeartbeatOptions struct {
+	VisibilityTimeout int64           // optional
+	MaxExtension      time.Duration   // optional
+	OnError           func(err error) // optional
+}
+
+// ProcessWithHeartbeat runs the handler on a message received with ReadMessage while extending the
+// visibility timeout of the message with ChangeMessageVisibility, so it is not received again while it
+// is being processed for longer than the visibility timeout of the queue. The heartbeats stop when the
+// handler returns, and the error of the handler is returned. The message is not deleted.
+//
+// When MaxExtension is reached the context of the handler is cancelled, since the message may be received
+// again by another consumer.
+//
+// Example:
+//
+//	err := ProcessWithHeartbeat(ctx, queueUrl, message, HeartbeatOptions{MaxExtension: time.Hour},
+//	    func(ctx context.Context, message *sqs.Message) error {
+//	        return runLongJob(ctx, *message.Body)
+//	    })
+//
+//	if err == nil {
+//	    err = DeleteMessage(queueUrl, *message.ReceiptHandle)
+//	}
+func ProcessWithHeartbeat(ctx context.Context, queueUrl string, message *sqs.Message, opts HeartbeatOptions, handler Handler) error {
+	opts = heartbeatDefaults(opts)
+
+	handlerCtx, cancel := context.WithTimeout(ctx, opts.MaxExtension)
+	defer cancel()
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		heartbeat(done, queueUrl, aws.StringValue(message.ReceiptHandle), opts)
+	}()
+
+	err := handler(handlerCtx, message)
+
+	close(done)
+	<-stopped
+
+	return err
+}
+
+func heartbeatDefaults(opts HeartbeatOptions) HeartbeatOptions {
+	if opts.VisibilityTimeout <= 0 {
+		opts.VisibilityTimeout = 30
+	}
+	if opts.MaxExtension <= 0 {
+		opts.MaxExtension = 12 * time.Hour
+	}
+	return opts
+}
+
+// heartbeat extends the visibility of a message until 'done' is closed or MaxExtension is reached.
+func heartbeat(done <-chan struct{}, queueUrl string, receiptHandle string, opts HeartbeatOptions) {
+	SQSclient := sqs.New(sessionutils.Session)
+
+	visibilityTimeout := time.Duration(opts.VisibilityTimeout) * time.Second
+	deadline := time.Now().Add(opts.MaxExtension)
+
+	ticker := time.NewTicker(visibilityTimeout / 2)
+	defer ticker.Stop()
+
+	for first := true; ; first = false {
+		// the first heartbeat is sent right away, since the message may have waited since it was received
+		if !first {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+
+		// the message is never kept invisible beyond the deadline
+		timeout := visibilityTimeout
+		if remaining := time.Until(deadline); remaining < timeout {
+			timeout = remaining
+		}
+		if timeout < time.Second {
+			return
+		}
+
+		_, err := SQSclient.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(queueUrl),
+			ReceiptHandle:     aws.String(sqsReceiptHandle(receiptHandle)),
+			VisibilityTimeout: aws.Int64(int64(timeout / time.Second)),
+		})
+
+		if err != nil && opts.OnError != nil {
+			opts.OnError(err)
+		}
+	}
+}
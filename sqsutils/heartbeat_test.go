@@ -0,0 +1,45 @@
+package sqsutils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+func TestProcessWithHeartbeat(t *testing.T) {
+	queueUrl := createQueue("heartbeat", QueueAttributes{VisibilityTimeout: 2})
+	defer DeleteQueue(queueUrl)
+
+	check(SendMessage(queueUrl, "long job", nil))
+
+	messages := readMessages(queueUrl, 1, 5*time.Second)
+	if len(messages) != 1 {
+		t.Fatalf("1 message should have been read but %d were", len(messages))
+	}
+
+	var heartbeatErr error
+	opts := HeartbeatOptions{VisibilityTimeout: 2, OnError: func(err error) { heartbeatErr = err }}
+
+	var redelivered []*sqs.Message
+	err := ProcessWithHeartbeat(context.Background(), queueUrl, messages[0], opts, func(ctx context.Context, message *sqs.Message) error {
+		// the job takes longer than the visibility timeout of the queue
+		time.Sleep(5 * time.Second)
+
+		read, err := ReadMessage(queueUrl, 10)
+		redelivered = read
+		return err
+	})
+	check(err)
+	check(heartbeatErr)
+
+	if len(redelivered) != 0 {
+		t.Errorf("the message should have been kept invisible while it was processed")
+	}
+
+	// the heartbeats stop with the handler, and the message, not deleted, becomes visible again
+	if again := readMessages(queueUrl, 1, 5*time.Second); len(again) != 1 {
+		t.Errorf("the message should be visible again after the handler returned")
+	}
+}
@@ -0,0 +1,171 @@
+package sqsutils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// Metadata describes a message received by a JSON handler.
+//   - Attributes: the message attributes, decoded as in DecodeMessageAttributes.
+//   - SentTimestamp: when the message was sent to the queue.
+//   - MessageGroupId: the group of the message on FIFO queues.
+//   - SNSNotification: the SNS notification that delivered the message, when it was unwrapped from an SNS
+//     envelope. Nil otherwise.
+//   - Message: the message received.
+type Metadata struct {
+	MessageId       string
+	ReceiptHandle   string
+	Attributes      map[string]interface{}
+	SentTimestamp   time.Time
+	MessageGroupId  string
+	SNSNotification *SNSNotification
+	Message         *sqs.Message
+}
+
+// JSONHandlerOptions holds the settings of a JSON handler.
+//   - PoisonSink: called with the messages whose body or attributes cannot be decoded, which would fail
+//     again on every delivery. When it returns nil the message is deleted from the queue. By default the
+//     decoding error is returned, leaving the message on the queue until it goes to the dead-letter queue,
+//     if the queue has one. See PoisonQueue.
+//   - UnwrapSNS: decode the message published to SNS when the body is an SNS envelope, as the option
+//     UnwrapSNS of the Consumer does. The envelopes that cannot be unwrapped go to the PoisonSink.
+type JSONHandlerOptions struct {
+	PoisonSink func(ctx context.Context, message *sqs.Message, err error) error // optional
+	UnwrapSNS  bool                                                             // optional
+}
+
+var (
+	contextType  = reflect.TypeOf((*context.Context)(nil)).Elem()
+	metadataType = reflect.TypeOf(Metadata{})
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// SendJSON marshals 'v' into a JSON string and sends it as the body of a message to the queue.
+// The attributes are encoded as in SendMessage.
+//
+// Example:
+//
+// err := SendJSON(queueUrl, order, map[string]interface{}{"type": "order-created"})
+func SendJSON(queueUrl string, v interface{}, messageAttributes map[string]interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return SendMessage(queueUrl, string(body), messageAttributes)
+}
+
+// JSONHandler creates a Handler that unmarshals the JSON body of the messages into the type of the second
+// parameter of 'handler', which must be a func(ctx context.Context, v T, metadata Metadata) error, where T
+// is any type json.Unmarshal can decode into.
+//
+// Example:
+//
+//	handler, err := JSONHandler(func(ctx context.Context, order Order, metadata Metadata) error {
+//	    return process(order)
+//	}, JSONHandlerOptions{PoisonSink: PoisonQueue(poisonQueueUrl)})
+//
+// consumer := NewConsumer(queueUrl, handler, ConsumerOptions{})
+//
+// The errors returned are:
+//   - an error if 'handler' does not have the required signature.
+func JSONHandler(handler interface{}, opts JSONHandlerOptions) (Handler, error) {
+	if handler == nil {
+		return nil, errors.New("sqsutils.JSONHandler: the handler cannot be nil")
+	}
+
+	handlerValue := reflect.ValueOf(handler)
+	handlerType := handlerValue.Type()
+
+	if handlerType.Kind() != reflect.Func ||
+		handlerType.NumIn() != 3 || handlerType.In(0) != contextType || handlerType.In(2) != metadataType ||
+		handlerType.NumOut() != 1 || handlerType.Out(0) != errorType {
+		return nil, fmt.Errorf("sqsutils.JSONHandler: the handler must be a func(context.Context, T, sqsutils.Metadata) error, not %s", handlerType)
+	}
+
+	valueType := handlerType.In(1)
+
+	return func(ctx context.Context, message *sqs.Message) error {
+		value := reflect.New(valueType)
+
+		var err error
+		if opts.UnwrapSNS && SNSNotificationFromContext(ctx) == nil {
+			ctx, message, err = unwrapSNSNotification(ctx, message)
+		}
+
+		metadata := Metadata{}
+		if err == nil {
+			metadata, err = newMetadata(ctx, message)
+		}
+		if err == nil {
+			err = json.Unmarshal([]byte(aws.StringValue(message.Body)), value.Interface())
+		}
+
+		if err != nil {
+			err = fmt.Errorf("sqsutils: the message %s cannot be decoded: %v", aws.StringValue(message.MessageId), err)
+			if opts.PoisonSink == nil {
+				return err
+			}
+			return opts.PoisonSink(ctx, message, err)
+		}
+
+		results := handlerValue.Call([]reflect.Value{reflect.ValueOf(ctx), value.Elem(), reflect.ValueOf(metadata)})
+
+		err, _ = results[0].Interface().(error)
+		return err
+	}, nil
+}
+
+// PoisonQueue returns a PoisonSink that sends the messages that cannot be decoded to another queue, with
+// their attributes plus the attribute "DecodeError" holding the error. The poison queue must be a standard queue.
+//
+// A message that already has the maximum of 10 attributes is sent without "DecodeError", since SQS would
+// reject it: its attributes are kept as they are so it can be sent back to its queue.
+func PoisonQueue(queueUrl string) func(ctx context.Context, message *sqs.Message, err error) error {
+	return func(ctx context.Context, message *sqs.Message, err error) error {
+		attributes := make(map[string]*sqs.MessageAttributeValue, len(message.MessageAttributes)+1)
+		for name, attribute := range message.MessageAttributes {
+			attributes[name] = attribute
+		}
+
+		if _, ok := attributes["DecodeError"]; ok || len(attributes) < maxMessageAttributes {
+			attributes["DecodeError"] = stringAttribute(StringDataType, err.Error())
+		}
+
+		return sendMessage(ctx, &sqs.SendMessageInput{
+			QueueUrl:          aws.String(queueUrl),
+			MessageBody:       message.Body,
+			MessageAttributes: attributes,
+		})
+	}
+}
+
+func newMetadata(ctx context.Context, message *sqs.Message) (Metadata, error) {
+	attributes, err := DecodeMessageAttributes(message.MessageAttributes)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	metadata := Metadata{
+		MessageId:       aws.StringValue(message.MessageId),
+		ReceiptHandle:   aws.StringValue(message.ReceiptHandle),
+		Attributes:      attributes,
+		MessageGroupId:  messageGroupId(message),
+		SNSNotification: SNSNotificationFromContext(ctx),
+		Message:         message,
+	}
+
+	if sent, err := strconv.ParseInt(aws.StringValue(message.Attributes[sqs.MessageSystemAttributeNameSentTimestamp]), 10, 64); err == nil {
+		metadata.SentTimestamp = time.Unix(0, sent*int64(time.Millisecond))
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,99 @@
+package sqsutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+type Order struct {
+	Id       int
+	Customer string
+}
+
+func TestJSONHandlerRoutesPoisonMessages(t *testing.T) {
+	queueUrl := createQueue("orders", QueueAttributes{})
+	defer DeleteQueue(queueUrl)
+	poisonQueueUrl := createQueue("orders-poison", QueueAttributes{})
+	defer DeleteQueue(poisonQueueUrl)
+
+	check(SendJSON(queueUrl, Order{Id: 1, Customer: "Maria"}, map[string]interface{}{"type": "order-created"}))
+	check(SendMessage(queueUrl, "not json", map[string]interface{}{"type": "order-created"}))
+
+	var mutex sync.Mutex
+	orders := []Order{}
+	types := []interface{}{}
+
+	handler, err := JSONHandler(func(ctx context.Context, order Order, metadata Metadata) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		orders = append(orders, order)
+		types = append(types, metadata.Attributes["type"])
+		return nil
+	}, JSONHandlerOptions{PoisonSink: PoisonQueue(poisonQueueUrl)})
+	check(err)
+
+	poisoned := []string{}
+	runConsumer(NewConsumer(queueUrl, handler, ConsumerOptions{WaitTimeSeconds: 1}), func() bool {
+		messages, err := ReadMessage(poisonQueueUrl, 10)
+		check(err)
+		for _, message := range messages {
+			decodeError := aws.StringValue(message.MessageAttributes["DecodeError"].StringValue)
+			if !strings.Contains(decodeError, "cannot be decoded") {
+				t.Errorf("the poison message should hold the decoding error but got '%s'", decodeError)
+			}
+			poisoned = append(poisoned, aws.StringValue(message.Body))
+			check(DeleteMessage(poisonQueueUrl, aws.StringValue(message.ReceiptHandle)))
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(orders) == 1 && len(poisoned) == 1
+	})
+
+	if len(orders) != 1 || orders[0] != (Order{Id: 1, Customer: "Maria"}) || types[0] != "order-created" {
+		t.Errorf("the order should have been handled with its attributes but got %v %v", orders, types)
+	}
+	if len(poisoned) != 1 || poisoned[0] != "not json" {
+		t.Errorf("1 message should have been sent to the poison queue but %d were: %v", len(poisoned), poisoned)
+	}
+
+	// the poison messages were deleted from the queue
+	if left := readMessages(queueUrl, 1, time.Second); len(left) != 0 {
+		t.Errorf("the queue should be empty but %d messages are left", len(left))
+	}
+}
+
+func TestPoisonQueueKeepsTheMaximumOfAttributes(t *testing.T) {
+	poisonQueueUrl := createQueue("full-poison", QueueAttributes{})
+	defer DeleteQueue(poisonQueueUrl)
+
+	values := map[string]interface{}{}
+	for i := 0; i < maxMessageAttributes; i++ {
+		values[fmt.Sprintf("attribute%d", i)] = i
+	}
+	attributes, err := encodeMessageAttributes(values)
+	check(err)
+
+	message := &sqs.Message{MessageId: aws.String("full"), Body: aws.String("not json"), MessageAttributes: attributes}
+	check(PoisonQueue(poisonQueueUrl)(context.Background(), message, errors.New("cannot be decoded")))
+
+	messages := readMessages(poisonQueueUrl, 1, 5*time.Second)
+	if len(messages) != 1 {
+		t.Fatalf("the message should have been sent to the poison queue but %d were read", len(messages))
+	}
+
+	decoded, err := DecodeMessageAttributes(messages[0].MessageAttributes)
+	check(err)
+
+	if len(decoded) != maxMessageAttributes || decoded["attribute9"] != int64(9) {
+		t.Errorf("the attributes of the message should have been kept but were %v", decoded)
+	}
+}
@@ -0,0 +1,242 @@
+package sqsutils
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/AmeDigital/aws-utils-go/s3utils"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// S3OffloadConfig configures the offloading of large message bodies to s3, which allows sending messages
+// bigger than the 256 KB limit of SQS.
+//   - BucketName: the bucket where the bodies are stored.
+//   - KeyPrefix: optional prefix of the keys of the objects created on the bucket.
+//   - Threshold: the size in bytes above which a body is offloaded, counting the attributes of the message
+//     as SQS does. Default MaxMessageSize.
+//   - OnDeleteError: called with the errors of deleting the s3 objects of the messages deleted, which are not
+//     returned by DeleteMessage and DeleteMessageBatch since the messages were deleted. The objects left
+//     on the bucket can be removed by a lifecycle rule. By default the errors are ignored.
+//
+// The messages are sent in the format of the Amazon SQS Extended Client Library: the body is replaced by a
+// pointer to the s3 object, and the attribute ExtendedPayloadSize tells the size of the original body. So
+// the messages can be exchanged with the applications using the extended clients of Java or Python.
+//
+// The messages sent with SendMessage, SendJSON, SendMessageBatch, SendFifoMessage and SendFifoMessageBatch
+// are offloaded. ReadMessage and the Consumer replace the pointer by the original body, and DeleteMessage and
+// DeleteMessageBatch delete the s3 object with the message. Reading the offloaded messages does not depend
+// on the configuration. The messages whose body cannot be read from s3 are not returned nor processed, and
+// are received again after their visibility timeout: their errors go to the OnLoadError of
+// ReadMessageWithOptions or to the OnError of the Consumer.
+//
+// Example:
+//
+// SetS3Offload(&S3OffloadConfig{BucketName: "large-messages"})
+type S3OffloadConfig struct {
+	BucketName    string          // mandatory
+	KeyPrefix     string          // optional
+	Threshold     int             // optional
+	OnDeleteError func(err error) // optional
+}
+
+var s3Offload *S3OffloadConfig
+
+// SetS3Offload enables offloading large message bodies to s3. Use SetS3Offload(nil) to disable it; the
+// messages already offloaded will still be read normally.
+func SetS3Offload(config *S3OffloadConfig) {
+	s3Offload = config
+}
+
+const (
+	// extendedPayloadSizeAttributeName is the attribute added by the extended clients to the offloaded messages.
+	extendedPayloadSizeAttributeName = "ExtendedPayloadSize"
+	// legacyPayloadSizeAttributeName is the attribute used by the first versions of the extended clients.
+	legacyPayloadSizeAttributeName = "SQSLargePayloadSize"
+	// s3PointerClassName is the first element of the pointers sent by the extended clients.
+	s3PointerClassName = "software.amazon.payloadoffloading.PayloadS3Pointer"
+
+	s3BucketNameMarker = "-..s3BucketName..-"
+	s3KeyMarker        = "-..s3Key..-"
+)
+
+type s3Pointer struct {
+	S3BucketName string `json:"s3BucketName"`
+	S3Key        string `json:"s3Key"`
+}
+
+// offloadBody stores the body on s3 when the message is larger than the threshold, returning the pointer
+// to be sent instead and the attributes with ExtendedPayloadSize.
+func offloadBody(body string, attributes map[string]*sqs.MessageAttributeValue) (string, map[string]*sqs.MessageAttributeValue, error) {
+	config := s3Offload
+	if config == nil {
+		return body, attributes, nil
+	}
+
+	threshold := config.Threshold
+	if threshold <= 0 {
+		threshold = MaxMessageSize
+	}
+
+	if messageSize(body, attributes) <= threshold {
+		return body, attributes, nil
+	}
+
+	if _, ok := attributes[extendedPayloadSizeAttributeName]; ok {
+		return "", nil, fmt.Errorf("sqsutils: the attribute %s is reserved to the messages offloaded to s3", extendedPayloadSizeAttributeName)
+	}
+
+	uuid, err := randomUUID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	key := config.KeyPrefix + uuid
+	if _, err := s3utils.PutObject(config.BucketName, key, body); err != nil {
+		return "", nil, err
+	}
+
+	pointer, err := json.Marshal([]interface{}{s3PointerClassName, s3Pointer{S3BucketName: config.BucketName, S3Key: key}})
+	if err != nil {
+		return "", nil, err
+	}
+
+	offloadedAttributes := make(map[string]*sqs.MessageAttributeValue, len(attributes)+1)
+	for name, attribute := range attributes {
+		offloadedAttributes[name] = attribute
+	}
+	offloadedAttributes[extendedPayloadSizeAttributeName] = stringAttribute(NumberDataType, strconv.Itoa(len(body)))
+
+	return string(pointer), offloadedAttributes, nil
+}
+
+// loadOffloadedBodies replaces the pointers of the offloaded messages by their bodies, read from s3, and
+// their receipt handles by the ones of the extended clients, which hold the location of the s3 object to be
+// deleted with the message. It returns the messages loaded; the messages whose body cannot be read are
+// passed to onError, if it is not nil, and left on the queue, to be received again after their visibility timeout.
+func loadOffloadedBodies(messages []*sqs.Message, onError func(err error, message *sqs.Message)) []*sqs.Message {
+	loaded := make([]*sqs.Message, 0, len(messages))
+
+	for _, message := range messages {
+		attributeName := extendedPayloadSizeAttributeName
+		if _, ok := message.MessageAttributes[attributeName]; !ok {
+			attributeName = legacyPayloadSizeAttributeName
+			if _, ok := message.MessageAttributes[attributeName]; !ok {
+				loaded = append(loaded, message)
+				continue
+			}
+		}
+
+		pointer, ok := parseS3Pointer(aws.StringValue(message.Body))
+		if !ok {
+			loaded = append(loaded, message)
+			continue
+		}
+
+		body, err := s3utils.GetObjectAsString(pointer.S3BucketName, pointer.S3Key)
+		if err != nil {
+			if onError != nil {
+				onError(fmt.Errorf("sqsutils: the body of the message %s cannot be read from s3: %v", aws.StringValue(message.MessageId), err), message)
+			}
+			continue
+		}
+
+		message.Body = aws.String(body)
+		message.MD5OfBody = nil
+		delete(message.MessageAttributes, attributeName)
+		message.ReceiptHandle = aws.String(s3BucketNameMarker + pointer.S3BucketName + s3BucketNameMarker +
+			s3KeyMarker + pointer.S3Key + s3KeyMarker + aws.StringValue(message.ReceiptHandle))
+		loaded = append(loaded, message)
+	}
+
+	return loaded
+}
+
+// parseS3Pointer parses the bodies sent by the extended clients: the current format, an array with the
+// class name and the pointer, or the legacy one, with the pointer only.
+func parseS3Pointer(body string) (s3Pointer, bool) {
+	pointer := s3Pointer{}
+
+	current := []json.RawMessage{}
+	if err := json.Unmarshal([]byte(body), &current); err == nil {
+		if len(current) != 2 || json.Unmarshal(current[1], &pointer) != nil {
+			return pointer, false
+		}
+	} else if err := json.Unmarshal([]byte(body), &pointer); err != nil {
+		return pointer, false
+	}
+
+	return pointer, len(pointer.S3BucketName) > 0 && len(pointer.S3Key) > 0
+}
+
+// parseReceiptHandle splits the receipt handles of the offloaded messages into the receipt handle of SQS
+// and the location of the s3 object. The other receipt handles are returned as they are, with ok false.
+func parseReceiptHandle(receiptHandle string) (sqsReceiptHandle string, pointer s3Pointer, ok bool) {
+	if !strings.HasPrefix(receiptHandle, s3BucketNameMarker) {
+		return receiptHandle, pointer, false
+	}
+
+	rest := strings.TrimPrefix(receiptHandle, s3BucketNameMarker)
+	parts := strings.SplitN(rest, s3BucketNameMarker+s3KeyMarker, 2)
+	if len(parts) != 2 {
+		return receiptHandle, pointer, false
+	}
+	pointer.S3BucketName = parts[0]
+
+	parts = strings.SplitN(parts[1], s3KeyMarker, 2)
+	if len(parts) != 2 {
+		return receiptHandle, pointer, false
+	}
+	pointer.S3Key = parts[0]
+
+	return parts[1], pointer, true
+}
+
+// sqsReceiptHandle returns the receipt handle of SQS of a message, which may be offloaded.
+func sqsReceiptHandle(receiptHandle string) string {
+	sqsReceiptHandle, _, _ := parseReceiptHandle(receiptHandle)
+	return sqsReceiptHandle
+}
+
+// deleteOffloadedBody deletes the s3 object of an offloaded message, after the message was deleted. Its
+// errors go to the OnDeleteError of the configuration, if it has one.
+func deleteOffloadedBody(receiptHandle string) {
+	_, pointer, ok := parseReceiptHandle(receiptHandle)
+	if !ok {
+		return
+	}
+
+	if err := s3utils.DeleteObject(pointer.S3BucketName, pointer.S3Key); err != nil {
+		err = fmt.Errorf("sqsutils: the body of the message deleted cannot be deleted from s3://%s/%s: %v", pointer.S3BucketName, pointer.S3Key, err)
+		if config := s3Offload; config != nil && config.OnDeleteError != nil {
+			config.OnDeleteError(err)
+		}
+	}
+}
+
+// deleteOffloadedPointer deletes the s3 object of a message that was offloaded but could not be sent.
+func deleteOffloadedPointer(input *sqs.SendMessageInput) {
+	if _, ok := input.MessageAttributes[extendedPayloadSizeAttributeName]; !ok {
+		return
+	}
+
+	if pointer, ok := parseS3Pointer(aws.StringValue(input.MessageBody)); ok {
+		s3utils.DeleteObject(pointer.S3BucketName, pointer.S3Key)
+	}
+}
+
+// randomUUID returns a random UUID (version 4), the format of the keys of the objects created by the
+// extended clients.
+func randomUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,86 @@
+package sqsutils
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AmeDigital/aws-utils-go/s3utils"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+func TestOffloadToS3(t *testing.T) {
+	bucket := "large-messages"
+	_, err := s3Client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	check(err)
+	defer s3Client.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String(bucket)})
+
+	queueUrl := createQueue("offload", QueueAttributes{})
+	defer DeleteQueue(queueUrl)
+
+	var deleteErr error
+	SetS3Offload(&S3OffloadConfig{BucketName: bucket, KeyPrefix: "messages/", Threshold: 1024, OnDeleteError: func(err error) { deleteErr = err }})
+	defer SetS3Offload(nil)
+
+	small := "small"
+	large := strings.Repeat("large ", 1000)
+	check(SendMessage(queueUrl, small, nil))
+	check(SendMessage(queueUrl, large, map[string]interface{}{"type": "report"}))
+
+	keys, err := s3utils.ListObjects(bucket, "messages/")
+	check(err)
+	if len(keys) != 1 {
+		t.Fatalf("only the large message should have been offloaded, but %d objects were created", len(keys))
+	}
+
+	messages := readMessages(queueUrl, 2, 5*time.Second)
+	if len(messages) != 2 {
+		t.Fatalf("2 messages should have been read but %d were", len(messages))
+	}
+
+	for _, message := range messages {
+		body := aws.StringValue(message.Body)
+		if body != small && body != large {
+			t.Errorf("the body should have been read from s3 but was '%.50s'", body)
+		}
+		if _, ok := message.MessageAttributes[extendedPayloadSizeAttributeName]; ok {
+			t.Errorf("the attribute %s should have been removed", extendedPayloadSizeAttributeName)
+		}
+
+		check(DeleteMessage(queueUrl, aws.StringValue(message.ReceiptHandle)))
+	}
+	check(deleteErr)
+
+	// deleting the message deletes its s3 object
+	keys, err = s3utils.ListObjects(bucket, "messages/")
+	check(err)
+	if len(keys) != 0 {
+		t.Errorf("the s3 object should have been deleted with the message, but %d objects are left", len(keys))
+	}
+}
+
+func TestOffloadedMessageNotReadFromS3(t *testing.T) {
+	queueUrl := createQueue("offload-missing", QueueAttributes{VisibilityTimeout: 1})
+	defer DeleteQueue(queueUrl)
+
+	// a pointer to an object that does not exist
+	check(SendMessage(queueUrl, `["`+s3PointerClassName+`", {"s3BucketName": "missing-bucket", "s3Key": "missing-key"}]`,
+		map[string]interface{}{extendedPayloadSizeAttributeName: 100}))
+
+	var loadErr error
+	opts := ReadMessageOptions{OnLoadError: func(err error, message *sqs.Message) { loadErr = err }}
+
+	messages, err := ReadMessageWithOptions(queueUrl, 10, opts)
+	for deadline := time.Now().Add(5 * time.Second); err == nil && loadErr == nil && time.Now().Before(deadline); {
+		time.Sleep(100 * time.Millisecond)
+		messages, err = ReadMessageWithOptions(queueUrl, 10, opts)
+	}
+	check(err)
+
+	if loadErr == nil || len(messages) != 0 {
+		t.Errorf("the message should not be returned and its error should be reported, but got %v %v", messages, loadErr)
+	}
+}
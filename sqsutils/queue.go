@@ -0,0 +1,384 @@
+package sqsutils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AmeDigital/aws-utils-go/sessionutils"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// QueueAttributes holds the attributes of a queue.
+//   - VisibilityTimeout: how long a message received stays invisible, in seconds, from 0 to 43200. Default 30.
+//   - MessageRetentionPeriod: how long a message is kept, in seconds, from 60 to 1209600 (14 days). Default 345600 (4 days).
+//   - DelaySeconds: how long a message sent stays invisible, in seconds, from 0 to 900. Default 0.
+//   - ReceiveMessageWaitTimeSeconds: the default long polling time of ReceiveMessage, from 0 to 20. Default 0.
+//   - MaximumMessageSize: the maximum size of a message, in bytes, from 1024 to 262144. Default 262144.
+//   - RedrivePolicy: moves the messages received more than MaxReceiveCount times to a dead-letter queue.
+//   - KmsMasterKeyId: the KMS key encrypting the messages, e.g. "alias/aws/sqs". Empty: not encrypted by KMS.
+//   - KmsDataKeyReusePeriodSeconds: how long a data key is reused, from 60 to 86400. Default 300.
+//   - SqsManagedSseEnabled: encrypt the messages with the keys managed by SQS.
+//   - FifoQueue: create a FIFO queue. The name of the queue must end with ".fifo". Cannot be changed.
+//   - ContentBasedDeduplication: on FIFO queues, use the SHA-256 of the body as the deduplication id of the
+//     messages sent without one.
+//   - Policy: the access policy of the queue, as a JSON document.
+//
+// The other fields are read only, returned by GetQueueAttributes.
+//
+// CreateQueue only sets the fields with non-zero values; the others keep the defaults of SQS. To change the
+// attributes of a queue, including to zero values, use SetQueueAttributes with a QueueAttributesUpdate.
+type QueueAttributes struct {
+	VisibilityTimeout             int64
+	MessageRetentionPeriod        int64
+	DelaySeconds                  int64
+	ReceiveMessageWaitTimeSeconds int64
+	MaximumMessageSize            int64
+	RedrivePolicy                 *RedrivePolicy
+	KmsMasterKeyId                string
+	KmsDataKeyReusePeriodSeconds  int64
+	SqsManagedSseEnabled          bool
+	FifoQueue                     bool
+	ContentBasedDeduplication     bool
+	Policy                        string
+
+	QueueArn                              string
+	ApproximateNumberOfMessages           int64
+	ApproximateNumberOfMessagesNotVisible int64
+	ApproximateNumberOfMessagesDelayed    int64
+	CreatedTimestamp                      time.Time
+	LastModifiedTimestamp                 time.Time
+}
+
+// RedrivePolicy moves to a dead-letter queue the messages received more than MaxReceiveCount times without
+// being deleted. The dead-letter queue of a FIFO queue must be a FIFO queue.
+type RedrivePolicy struct {
+	DeadLetterTargetArn string // mandatory
+	MaxReceiveCount     int64  // mandatory
+}
+
+// QueueAttributesUpdate holds the attributes changed by SetQueueAttributes, with the meaning of the fields
+// of QueueAttributes. The nil fields keep their current values, so the zero values can be set, e.g.
+// DelaySeconds: aws.Int64(0) or KmsMasterKeyId: aws.String("") to stop encrypting with KMS.
+//   - RemoveRedrivePolicy: removes the RedrivePolicy of the queue, which stops moving the messages to the
+//     dead-letter queue. Cannot be used with RedrivePolicy.
+type QueueAttributesUpdate struct {
+	VisibilityTimeout             *int64         // optional
+	MessageRetentionPeriod        *int64         // optional
+	DelaySeconds                  *int64         // optional
+	ReceiveMessageWaitTimeSeconds *int64         // optional
+	MaximumMessageSize            *int64         // optional
+	RedrivePolicy                 *RedrivePolicy // optional
+	RemoveRedrivePolicy           bool           // optional
+	KmsMasterKeyId                *string        // optional
+	KmsDataKeyReusePeriodSeconds  *int64         // optional
+	SqsManagedSseEnabled          *bool          // optional
+	ContentBasedDeduplication     *bool          // optional
+	Policy                        *string        // optional
+}
+
+// CreateQueue creates a queue and returns its url. Creating a queue that already exists with the same
+// attributes returns the url of the existing queue.
+//
+// Example:
+//
+//	dlqUrl, err := CreateQueue("orders-dlq.fifo", QueueAttributes{FifoQueue: true})
+//	dlq, err := GetQueueAttributes(dlqUrl)
+//	queueUrl, err := CreateQueue("orders.fifo", QueueAttributes{
+//	    FifoQueue:                 true,
+//	    ContentBasedDeduplication: true,
+//	    VisibilityTimeout:         60,
+//	    RedrivePolicy:             &RedrivePolicy{DeadLetterTargetArn: dlq.QueueArn, MaxReceiveCount: 5},
+//	    KmsMasterKeyId:            "alias/aws/sqs",
+//	})
+//
+// The errors returned are:
+//   - QueueAlreadyExists: a queue with the same name and different attributes exists.
+//   - an error if FifoQueue does not match the suffix ".fifo" of the name.
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/sqs/#SQS.CreateQueue
+func CreateQueue(queueName string, attributes QueueAttributes) (string, error) {
+	if attributes.FifoQueue != strings.HasSuffix(queueName, ".fifo") {
+		return "", fmt.Errorf("sqsutils.CreateQueue: the name of the queue %s must end with .fifo if and only if it is a FIFO queue", queueName)
+	}
+
+	encoded, err := encodeQueueAttributes(attributes)
+	if err != nil {
+		return "", err
+	}
+
+	SQSclient := sqs.New(sessionutils.Session)
+
+	output, err := SQSclient.CreateQueue(&sqs.CreateQueueInput{
+		QueueName:  aws.String(queueName),
+		Attributes: encoded,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(output.QueueUrl), nil
+}
+
+// GetQueueUrl returns the url of a queue from its name.
+//
+// The errors returned are:
+//   - AWS.SimpleQueueService.NonExistentQueue: the queue does not exist.
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/sqs/#SQS.GetQueueUrl
+func GetQueueUrl(queueName string) (string, error) {
+	SQSclient := sqs.New(sessionutils.Session)
+
+	output, err := SQSclient.GetQueueUrl(&sqs.GetQueueUrlInput{
+		QueueName: aws.String(queueName),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(output.QueueUrl), nil
+}
+
+// DeleteQueue deletes a queue and its messages. SQS may take up to 60 seconds to delete it, and a queue with
+// the same name cannot be created in this period.
+func DeleteQueue(queueUrl string) error {
+	SQSclient := sqs.New(sessionutils.Session)
+
+	_, err := SQSclient.DeleteQueue(&sqs.DeleteQueueInput{
+		QueueUrl: aws.String(queueUrl),
+	})
+
+	return err
+}
+
+// PurgeQueue deletes all the messages of a queue. The bodies of the messages offloaded to s3 are not deleted.
+//
+// The errors returned are:
+//   - AWS.SimpleQueueService.PurgeQueueInProgress: the queue was purged in the last 60 seconds.
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/sqs/#SQS.PurgeQueue
+func PurgeQueue(queueUrl string) error {
+	SQSclient := sqs.New(sessionutils.Session)
+
+	_, err := SQSclient.PurgeQueue(&sqs.PurgeQueueInput{
+		QueueUrl: aws.String(queueUrl),
+	})
+
+	return err
+}
+
+// SetQueueAttributes changes the attributes of a queue with non-nil values in 'attributes'.
+//
+// Example:
+//
+//	err := SetQueueAttributes(queueUrl, QueueAttributesUpdate{
+//	    DelaySeconds:        aws.Int64(0),
+//	    RemoveRedrivePolicy: true,
+//	})
+//
+// The errors returned are:
+//   - an error if both RedrivePolicy and RemoveRedrivePolicy are set.
+//   - errors from the aws sdk: see https://docs.aws.amazon.com/sdk-for-go/api/service/sqs/#SQS.SetQueueAttributes
+func SetQueueAttributes(queueUrl string, attributes QueueAttributesUpdate) error {
+	encoded, err := encodeQueueAttributesUpdate(attributes)
+	if err != nil {
+		return err
+	}
+
+	if len(encoded) == 0 {
+		return nil
+	}
+
+	SQSclient := sqs.New(sessionutils.Session)
+
+	_, err = SQSclient.SetQueueAttributes(&sqs.SetQueueAttributesInput{
+		QueueUrl:   aws.String(queueUrl),
+		Attributes: encoded,
+	})
+
+	return err
+}
+
+// GetQueueAttributes returns all the attributes of a queue.
+//
+// Example:
+//
+//	attributes, err := GetQueueAttributes(queueUrl)
+//	fmt.Println(attributes.QueueArn, attributes.ApproximateNumberOfMessages)
+func GetQueueAttributes(queueUrl string) (QueueAttributes, error) {
+	SQSclient := sqs.New(sessionutils.Session)
+
+	output, err := SQSclient.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueUrl),
+		AttributeNames: []*string{aws.String(sqs.QueueAttributeNameAll)},
+	})
+	if err != nil {
+		return QueueAttributes{}, err
+	}
+
+	return decodeQueueAttributes(aws.StringValueMap(output.Attributes))
+}
+
+type redrivePolicyJSON struct {
+	DeadLetterTargetArn string      `json:"deadLetterTargetArn"`
+	MaxReceiveCount     json.Number `json:"maxReceiveCount"`
+}
+
+func encodeQueueAttributes(attributes QueueAttributes) (map[string]*string, error) {
+	encoded := make(map[string]*string)
+
+	setInt := func(name string, value int64) {
+		if value != 0 {
+			encoded[name] = aws.String(strconv.FormatInt(value, 10))
+		}
+	}
+	setBool := func(name string, value bool) {
+		if value {
+			encoded[name] = aws.String("true")
+		}
+	}
+	setString := func(name string, value string) {
+		if len(value) > 0 {
+			encoded[name] = aws.String(value)
+		}
+	}
+
+	setInt(sqs.QueueAttributeNameVisibilityTimeout, attributes.VisibilityTimeout)
+	setInt(sqs.QueueAttributeNameMessageRetentionPeriod, attributes.MessageRetentionPeriod)
+	setInt(sqs.QueueAttributeNameDelaySeconds, attributes.DelaySeconds)
+	setInt(sqs.QueueAttributeNameReceiveMessageWaitTimeSeconds, attributes.ReceiveMessageWaitTimeSeconds)
+	setInt(sqs.QueueAttributeNameMaximumMessageSize, attributes.MaximumMessageSize)
+	setString(sqs.QueueAttributeNameKmsMasterKeyId, attributes.KmsMasterKeyId)
+	setInt(sqs.QueueAttributeNameKmsDataKeyReusePeriodSeconds, attributes.KmsDataKeyReusePeriodSeconds)
+	setBool(sqs.QueueAttributeNameSqsManagedSseEnabled, attributes.SqsManagedSseEnabled)
+	setBool(sqs.QueueAttributeNameFifoQueue, attributes.FifoQueue)
+	setBool(sqs.QueueAttributeNameContentBasedDeduplication, attributes.ContentBasedDeduplication)
+	setString(sqs.QueueAttributeNamePolicy, attributes.Policy)
+
+	if attributes.RedrivePolicy != nil {
+		policy, err := encodeRedrivePolicy(attributes.RedrivePolicy)
+		if err != nil {
+			return nil, err
+		}
+		encoded[sqs.QueueAttributeNameRedrivePolicy] = aws.String(policy)
+	}
+
+	return encoded, nil
+}
+
+func encodeQueueAttributesUpdate(attributes QueueAttributesUpdate) (map[string]*string, error) {
+	if attributes.RedrivePolicy != nil && attributes.RemoveRedrivePolicy {
+		return nil, errors.New("sqsutils.SetQueueAttributes: RedrivePolicy and RemoveRedrivePolicy cannot be used together")
+	}
+
+	encoded := make(map[string]*string)
+
+	setInt := func(name string, value *int64) {
+		if value != nil {
+			encoded[name] = aws.String(strconv.FormatInt(*value, 10))
+		}
+	}
+	setBool := func(name string, value *bool) {
+		if value != nil {
+			encoded[name] = aws.String(strconv.FormatBool(*value))
+		}
+	}
+	setString := func(name string, value *string) {
+		if value != nil {
+			encoded[name] = aws.String(*value)
+		}
+	}
+
+	setInt(sqs.QueueAttributeNameVisibilityTimeout, attributes.VisibilityTimeout)
+	setInt(sqs.QueueAttributeNameMessageRetentionPeriod, attributes.MessageRetentionPeriod)
+	setInt(sqs.QueueAttributeNameDelaySeconds, attributes.DelaySeconds)
+	setInt(sqs.QueueAttributeNameReceiveMessageWaitTimeSeconds, attributes.ReceiveMessageWaitTimeSeconds)
+	setInt(sqs.QueueAttributeNameMaximumMessageSize, attributes.MaximumMessageSize)
+	setString(sqs.QueueAttributeNameKmsMasterKeyId, attributes.KmsMasterKeyId)
+	setInt(sqs.QueueAttributeNameKmsDataKeyReusePeriodSeconds, attributes.KmsDataKeyReusePeriodSeconds)
+	setBool(sqs.QueueAttributeNameSqsManagedSseEnabled, attributes.SqsManagedSseEnabled)
+	setBool(sqs.QueueAttributeNameContentBasedDeduplication, attributes.ContentBasedDeduplication)
+	setString(sqs.QueueAttributeNamePolicy, attributes.Policy)
+
+	if attributes.RedrivePolicy != nil {
+		policy, err := encodeRedrivePolicy(attributes.RedrivePolicy)
+		if err != nil {
+			return nil, err
+		}
+		encoded[sqs.QueueAttributeNameRedrivePolicy] = aws.String(policy)
+	}
+
+	// SQS removes the redrive policy when it is set to an empty string
+	if attributes.RemoveRedrivePolicy {
+		encoded[sqs.QueueAttributeNameRedrivePolicy] = aws.String("")
+	}
+
+	return encoded, nil
+}
+
+func encodeRedrivePolicy(redrivePolicy *RedrivePolicy) (string, error) {
+	policy, err := json.Marshal(redrivePolicyJSON{
+		DeadLetterTargetArn: redrivePolicy.DeadLetterTargetArn,
+		MaxReceiveCount:     json.Number(strconv.FormatInt(redrivePolicy.MaxReceiveCount, 10)),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(policy), nil
+}
+
+func decodeQueueAttributes(attributes map[string]string) (QueueAttributes, error) {
+	decoded := QueueAttributes{
+		KmsMasterKeyId: attributes[sqs.QueueAttributeNameKmsMasterKeyId],
+		Policy:         attributes[sqs.QueueAttributeNamePolicy],
+		QueueArn:       attributes[sqs.QueueAttributeNameQueueArn],
+	}
+
+	getInt := func(name string) int64 {
+		value, _ := strconv.ParseInt(attributes[name], 10, 64)
+		return value
+	}
+	getBool := func(name string) bool {
+		value, _ := strconv.ParseBool(attributes[name])
+		return value
+	}
+	getTime := func(name string) time.Time {
+		if seconds := getInt(name); seconds > 0 {
+			return time.Unix(seconds, 0)
+		}
+		return time.Time{}
+	}
+
+	decoded.VisibilityTimeout = getInt(sqs.QueueAttributeNameVisibilityTimeout)
+	decoded.MessageRetentionPeriod = getInt(sqs.QueueAttributeNameMessageRetentionPeriod)
+	decoded.DelaySeconds = getInt(sqs.QueueAttributeNameDelaySeconds)
+	decoded.ReceiveMessageWaitTimeSeconds = getInt(sqs.QueueAttributeNameReceiveMessageWaitTimeSeconds)
+	decoded.MaximumMessageSize = getInt(sqs.QueueAttributeNameMaximumMessageSize)
+	decoded.KmsDataKeyReusePeriodSeconds = getInt(sqs.QueueAttributeNameKmsDataKeyReusePeriodSeconds)
+	decoded.SqsManagedSseEnabled = getBool(sqs.QueueAttributeNameSqsManagedSseEnabled)
+	decoded.FifoQueue = getBool(sqs.QueueAttributeNameFifoQueue)
+	decoded.ContentBasedDeduplication = getBool(sqs.QueueAttributeNameContentBasedDeduplication)
+	decoded.ApproximateNumberOfMessages = getInt(sqs.QueueAttributeNameApproximateNumberOfMessages)
+	decoded.ApproximateNumberOfMessagesNotVisible = getInt(sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible)
+	decoded.ApproximateNumberOfMessagesDelayed = getInt(sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed)
+	decoded.CreatedTimestamp = getTime(sqs.QueueAttributeNameCreatedTimestamp)
+	decoded.LastModifiedTimestamp = getTime(sqs.QueueAttributeNameLastModifiedTimestamp)
+
+	if policy, ok := attributes[sqs.QueueAttributeNameRedrivePolicy]; ok && len(policy) > 0 {
+		redrive := redrivePolicyJSON{}
+		if err := json.Unmarshal([]byte(policy), &redrive); err != nil {
+			return decoded, fmt.Errorf("sqsutils: invalid redrive policy %s: %v", policy, err)
+		}
+
+		maxReceiveCount, _ := redrive.MaxReceiveCount.Int64()
+		decoded.RedrivePolicy = &RedrivePolicy{
+			DeadLetterTargetArn: redrive.DeadLetterTargetArn,
+			MaxReceiveCount:     maxReceiveCount,
+		}
+	}
+
+	return decoded, nil
+}
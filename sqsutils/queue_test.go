@@ -0,0 +1,69 @@
+package sqsutils
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestCreateQueueAndGetQueueAttributes(t *testing.T) {
+	dlqUrl := createQueue("queue-attributes-dlq", QueueAttributes{})
+	defer DeleteQueue(dlqUrl)
+
+	dlq, err := GetQueueAttributes(dlqUrl)
+	check(err)
+
+	queueUrl := createQueue("queue-attributes", QueueAttributes{
+		VisibilityTimeout:      60,
+		MessageRetentionPeriod: 86400,
+		DelaySeconds:           5,
+		MaximumMessageSize:     1024,
+		RedrivePolicy:          &RedrivePolicy{DeadLetterTargetArn: dlq.QueueArn, MaxReceiveCount: 3},
+	})
+	defer DeleteQueue(queueUrl)
+
+	if found, err := GetQueueUrl("queue-attributes"); err != nil || found != queueUrl {
+		t.Errorf("GetQueueUrl should return %s but returned %s, %v", queueUrl, found, err)
+	}
+
+	attributes, err := GetQueueAttributes(queueUrl)
+	check(err)
+
+	if attributes.VisibilityTimeout != 60 || attributes.MessageRetentionPeriod != 86400 ||
+		attributes.DelaySeconds != 5 || attributes.MaximumMessageSize != 1024 || len(attributes.QueueArn) == 0 {
+		t.Errorf("unexpected attributes %+v", attributes)
+	}
+	if attributes.RedrivePolicy == nil || *attributes.RedrivePolicy != (RedrivePolicy{DeadLetterTargetArn: dlq.QueueArn, MaxReceiveCount: 3}) {
+		t.Errorf("unexpected redrive policy %+v", attributes.RedrivePolicy)
+	}
+
+	// the zero values are set and the redrive policy is removed
+	check(SetQueueAttributes(queueUrl, QueueAttributesUpdate{
+		VisibilityTimeout:   aws.Int64(0),
+		DelaySeconds:        aws.Int64(0),
+		RemoveRedrivePolicy: true,
+	}))
+
+	attributes, err = GetQueueAttributes(queueUrl)
+	check(err)
+
+	if attributes.VisibilityTimeout != 0 || attributes.DelaySeconds != 0 || attributes.RedrivePolicy != nil {
+		t.Errorf("the attributes should have been cleared but were %+v", attributes)
+	}
+	if attributes.MessageRetentionPeriod != 86400 {
+		t.Errorf("the attributes not set should have been kept but were %+v", attributes)
+	}
+
+	if err := SetQueueAttributes(queueUrl, QueueAttributesUpdate{RedrivePolicy: &RedrivePolicy{}, RemoveRedrivePolicy: true}); err == nil {
+		t.Error("RedrivePolicy and RemoveRedrivePolicy should not be accepted together")
+	}
+}
+
+func TestCreateQueueChecksTheFifoSuffix(t *testing.T) {
+	if _, err := CreateQueue("not-fifo", QueueAttributes{FifoQueue: true}); err == nil {
+		t.Error("a FIFO queue without the suffix .fifo should have been rejected")
+	}
+	if _, err := CreateQueue("standard.fifo", QueueAttributes{}); err == nil {
+		t.Error("a standard queue with the suffix .fifo should have been rejected")
+	}
+}
@@ -0,0 +1,106 @@
+package sqsutils
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// SNSNotification describes the SNS notification that delivered a message to a queue subscribed to a topic
+// without raw message delivery.
+type SNSNotification struct {
+	MessageId string
+	TopicArn  string
+	Subject   string
+	Timestamp time.Time
+}
+
+// snsEnvelope is the body of the messages delivered by SNS without raw message delivery.
+type snsEnvelope struct {
+	Type              string
+	MessageId         string
+	TopicArn          string
+	Subject           string
+	Message           *string
+	Timestamp         time.Time
+	MessageAttributes map[string]struct {
+		Type  string
+		Value string
+	}
+}
+
+type snsNotificationKey struct{}
+
+// UnwrapSNSNotification detects the messages whose body is the envelope of an SNS notification and returns
+// a copy of the message with the body and the attributes published to the topic, and the notification.
+// The other messages are returned as they are, with a nil notification.
+//
+// An error is returned when the message is an SNS envelope that cannot be unwrapped, e.g. with a Binary
+// attribute that is not valid base64, since handling the envelope as the message would go unnoticed.
+//
+// Example:
+//
+//	messages, err := ReadMessage(queueUrl, 10)
+//	...
+//	message, notification, err := UnwrapSNSNotification(messages[0])
+//	if notification != nil {
+//	    fmt.Println("published to", notification.TopicArn, "at", notification.Timestamp)
+//	}
+func UnwrapSNSNotification(message *sqs.Message) (*sqs.Message, *SNSNotification, error) {
+	envelope := snsEnvelope{}
+	if err := json.Unmarshal([]byte(aws.StringValue(message.Body)), &envelope); err != nil {
+		return message, nil, nil
+	}
+
+	if envelope.Type != "Notification" || len(envelope.TopicArn) == 0 || envelope.Message == nil {
+		return message, nil, nil
+	}
+
+	attributes := make(map[string]*sqs.MessageAttributeValue, len(envelope.MessageAttributes))
+	for name, attribute := range envelope.MessageAttributes {
+		if baseDataType(attribute.Type) == BinaryDataType {
+			binary, err := base64.StdEncoding.DecodeString(attribute.Value)
+			if err != nil {
+				return message, nil, fmt.Errorf("sqsutils: the attribute %s of the SNS notification %s is not valid base64: %v", name, envelope.MessageId, err)
+			}
+			attributes[name] = &sqs.MessageAttributeValue{DataType: aws.String(attribute.Type), BinaryValue: binary}
+		} else {
+			attributes[name] = stringAttribute(attribute.Type, attribute.Value)
+		}
+	}
+
+	unwrapped := *message
+	unwrapped.Body = envelope.Message
+	unwrapped.MessageAttributes = attributes
+	unwrapped.MD5OfBody = nil
+	unwrapped.MD5OfMessageAttributes = nil
+
+	return &unwrapped, &SNSNotification{
+		MessageId: envelope.MessageId,
+		TopicArn:  envelope.TopicArn,
+		Subject:   envelope.Subject,
+		Timestamp: envelope.Timestamp,
+	}, nil
+}
+
+// SNSNotificationFromContext returns the SNS notification of the message being processed by a handler of a
+// Consumer with the option UnwrapSNS, or nil if the message was not delivered in an SNS envelope.
+func SNSNotificationFromContext(ctx context.Context) *SNSNotification {
+	notification, _ := ctx.Value(snsNotificationKey{}).(*SNSNotification)
+	return notification
+}
+
+// unwrapSNSNotification unwraps the message and stores its notification in the context.
+func unwrapSNSNotification(ctx context.Context, message *sqs.Message) (context.Context, *sqs.Message, error) {
+	message, notification, err := UnwrapSNSNotification(message)
+	if err != nil || notification == nil {
+		return ctx, message, err
+	}
+
+	return context.WithValue(ctx, snsNotificationKey{}, notification), message, nil
+}
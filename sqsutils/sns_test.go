@@ -0,0 +1,111 @@
+package sqsutils
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+func TestUnwrapSNSNotification(t *testing.T) {
+	queueUrl := createQueue("sns-subscription", QueueAttributes{})
+	defer DeleteQueue(queueUrl)
+
+	envelope := `{
+		"Type": "Notification",
+		"MessageId": "b1946ac9-2f4b-4f0c-9c1c-6b7ef5a5e2f0",
+		"TopicArn": "arn:aws:sns:us-east-1:000000000000:orders",
+		"Subject": "created",
+		"Message": "{\"id\": 7}",
+		"Timestamp": "2022-04-20T12:00:00.000Z",
+		"MessageAttributes": {
+			"type": {"Type": "String", "Value": "order-created"},
+			"signature": {"Type": "Binary", "Value": "AQID"}
+		}
+	}`
+	check(SendMessage(queueUrl, envelope, nil))
+
+	type unwrapped struct {
+		body         string
+		attributes   map[string]interface{}
+		notification *SNSNotification
+	}
+	received := make(chan unwrapped, 1)
+
+	consumer := NewConsumer(queueUrl, func(ctx context.Context, message *sqs.Message) error {
+		attributes, err := DecodeMessageAttributes(message.MessageAttributes)
+		received <- unwrapped{aws.StringValue(message.Body), attributes, SNSNotificationFromContext(ctx)}
+		return err
+	}, ConsumerOptions{WaitTimeSeconds: 1, UnwrapSNS: true})
+
+	runConsumer(consumer, func() bool { return len(received) > 0 })
+
+	if len(received) == 0 {
+		t.Fatal("the message was not processed")
+	}
+	result := <-received
+
+	if result.notification == nil {
+		t.Fatal("the notification should have been unwrapped")
+	}
+	if result.notification.TopicArn != "arn:aws:sns:us-east-1:000000000000:orders" || result.notification.Subject != "created" {
+		t.Errorf("unexpected notification %+v", result.notification)
+	}
+	if result.body != `{"id": 7}` {
+		t.Errorf("the body should be the message published but was '%s'", result.body)
+	}
+
+	expected := map[string]interface{}{"type": "order-created", "signature": []byte{1, 2, 3}}
+	if !reflect.DeepEqual(result.attributes, expected) {
+		t.Errorf("Expected: %v, Result: %v", expected, result.attributes)
+	}
+
+	// a Binary attribute that is not base64 is an error, instead of the envelope being handled as the message
+	invalid := &sqs.Message{Body: aws.String(`{"Type": "Notification", "TopicArn": "arn:aws:sns:us-east-1:000000000000:orders",
+		"Message": "{}", "MessageAttributes": {"signature": {"Type": "Binary", "Value": "not base64!"}}}`)}
+
+	if _, _, err := UnwrapSNSNotification(invalid); err == nil {
+		t.Error("the invalid Binary attribute should have been rejected")
+	}
+}
+
+func TestJSONHandlerPoisonsInvalidSNSEnvelopes(t *testing.T) {
+	queueUrl := createQueue("sns-orders", QueueAttributes{})
+	defer DeleteQueue(queueUrl)
+	poisonQueueUrl := createQueue("sns-orders-poison", QueueAttributes{})
+	defer DeleteQueue(poisonQueueUrl)
+
+	// an SNS envelope that cannot be unwrapped is poison
+	check(SendMessage(queueUrl, `{"Type": "Notification", "TopicArn": "arn:aws:sns:us-east-1:000000000000:orders",
+		"Message": "{}", "MessageAttributes": {"signature": {"Type": "Binary", "Value": "not base64!"}}}`, nil))
+
+	var mutex sync.Mutex
+	handled := 0
+
+	handler, err := JSONHandler(func(ctx context.Context, order Order, metadata Metadata) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		handled++
+		return nil
+	}, JSONHandlerOptions{PoisonSink: PoisonQueue(poisonQueueUrl), UnwrapSNS: true})
+	check(err)
+
+	poisoned := []*sqs.Message{}
+	runConsumer(NewConsumer(queueUrl, handler, ConsumerOptions{WaitTimeSeconds: 1}), func() bool {
+		messages, err := ReadMessage(poisonQueueUrl, 10)
+		check(err)
+		poisoned = append(poisoned, messages...)
+		return len(poisoned) > 0
+	})
+
+	if len(poisoned) != 1 || handled != 0 {
+		t.Fatalf("the envelope should have been sent to the poison queue, but %d were and %d handled", len(poisoned), handled)
+	}
+	if decodeError := aws.StringValue(poisoned[0].MessageAttributes["DecodeError"].StringValue); !strings.Contains(decodeError, "cannot be decoded") {
+		t.Errorf("the poison message should hold the decoding error but got '%s'", decodeError)
+	}
+}
@@ -1,40 +1,26 @@
 package sqsutils
 
 import (
+	"context"
 	"fmt"
-	"reflect"
-	"errors"
 	"github.com/AmeDigital/aws-utils-go/sessionutils"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/sqs"
 )
 
-func convertAWSDataType(value interface{}) (string, error) {
-	typeof := reflect.TypeOf(value)
-
-	switch typeof.Kind() {
-		case reflect.String:
-			return "String", nil
-		case reflect.Array, reflect.Slice:
-			return "String.Array", nil
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
-			return "Number", nil
-		default:
-			return "", errors.New("Type unknown")
-	}
-}
-
+// GetMessageAttribute returns an attribute of the queue, e.g. "ApproximateNumberOfMessages", as a string.
+// See GetQueueAttributes to read all the attributes of a queue with their types.
 func GetMessageAttribute(queueUrl string, attributeName string) (string, error) {
 	SQSclient := sqs.New(sessionutils.Session)
-	
+
 	var attributesNamesList []*string
-	
+
 	attributesNamesList = append(attributesNamesList, aws.String(attributeName))
 
 	response, err := SQSclient.GetQueueAttributes(&sqs.GetQueueAttributesInput{
 		AttributeNames: attributesNamesList,
-		QueueUrl:    &queueUrl,
+		QueueUrl:       &queueUrl,
 	})
 
 	if err != nil {
@@ -44,63 +30,83 @@ func GetMessageAttribute(queueUrl string, attributeName string) (string, error)
 	return *response.Attributes[attributeName], err
 }
 
+// SendMessage sends a message to the queue. The attributes can be strings, numbers, []byte, slices or
+// MessageAttribute values with a custom data type; see DecodeMessageAttributes to read them back.
+// Large messages are offloaded to s3 when SetS3Offload is enabled.
 func SendMessage(queueUrl string, message string, messageAttributes map[string]interface{}) error {
 	sendMessageInput := sqs.SendMessageInput{
 		MessageBody: aws.String(message),
 		QueueUrl:    &queueUrl,
 	}
 
-	if messageAttributes != nil {
-		msgAttributeValueMap := make(map[string]*sqs.MessageAttributeValue, len(messageAttributes))
-
-		for key, value := range messageAttributes {
-			dataType, err := convertAWSDataType(value)
-
-			if err != nil {
-				return err
-			}
+	msgAttributeValueMap, err := encodeMessageAttributes(messageAttributes)
+	if err != nil {
+		return err
+	}
+	sendMessageInput.MessageAttributes = msgAttributeValueMap
 
-			msgAttributeValueMap[key] = &sqs.MessageAttributeValue{
-				DataType:    aws.String(dataType),
-				StringValue: aws.String(value.(string)),
-			}
-		}
+	return sendMessage(context.Background(), &sendMessageInput)
+}
 
-		sendMessageInput.MessageAttributes = msgAttributeValueMap
+// sendMessage sends a message, offloading its body to s3 if needed. The s3 object is deleted if the message
+// cannot be sent.
+func sendMessage(ctx context.Context, input *sqs.SendMessageInput) error {
+	body, attributes, err := offloadBody(aws.StringValue(input.MessageBody), input.MessageAttributes)
+	if err != nil {
+		return err
 	}
+	input.MessageBody, input.MessageAttributes = aws.String(body), attributes
 
 	SQSclient := sqs.New(sessionutils.Session)
 
-	_, err := SQSclient.SendMessage(&sendMessageInput)
+	_, err = SQSclient.SendMessageWithContext(ctx, input)
+	if err != nil {
+		deleteOffloadedPointer(input)
+	}
 
 	return err
 }
 
+// ReadMessage reads up to 'maxNumberOfMessages' messages from the queue, without waiting for messages
+// to arrive if the queue is empty. Use a Consumer to keep reading the messages of a queue.
+// The bodies of the messages offloaded to s3 are read from s3. The messages whose body cannot be read are
+// not returned and are received again after their visibility timeout; use ReadMessageWithOptions to get
+// their errors.
 func ReadMessage(queueUrl string, maxNumberOfMessages int64) ([]*sqs.Message, error) {
+	return ReadMessageWithOptions(queueUrl, maxNumberOfMessages, ReadMessageOptions{})
+}
 
-	SQSclient := sqs.New(sessionutils.Session)
+// ReadMessageOptions holds the options of ReadMessageWithOptions.
+//   - OnLoadError: called with each message whose body cannot be read from s3 and its error. The message
+//     is not returned.
+type ReadMessageOptions struct {
+	OnLoadError func(err error, message *sqs.Message) // optional
+}
 
-	result, err := SQSclient.ReceiveMessage(&sqs.ReceiveMessageInput{
-		AttributeNames: []*string{
-			aws.String(sqs.MessageSystemAttributeNameSentTimestamp),
-		},
-		MessageAttributeNames: []*string{
-			aws.String(sqs.QueueAttributeNameAll),
-		},
-		QueueUrl:            &queueUrl,
-		MaxNumberOfMessages: &maxNumberOfMessages,
-		WaitTimeSeconds:     aws.Int64(0), //(Optional) Timeout in seconds for long polling
+// ReadMessageWithOptions works like ReadMessage with the given options.
+//
+// Example:
+//
+//	messages, err := ReadMessageWithOptions(queueUrl, 10, ReadMessageOptions{
+//	    OnLoadError: func(err error, message *sqs.Message) {
+//	        log.Println("the message", aws.StringValue(message.MessageId), "cannot be read:", err)
+//	    },
+//	})
+func ReadMessageWithOptions(queueUrl string, maxNumberOfMessages int64, opts ReadMessageOptions) ([]*sqs.Message, error) {
+	return receiveMessages(context.Background(), queueUrl, receiveOptions{
+		MaxNumberOfMessages: maxNumberOfMessages,
+		OnLoadError:         opts.OnLoadError,
 	})
-
-	return result.Messages, err
 }
 
+// DeleteMessage deletes a message from the queue. The body of a message offloaded to s3 is deleted from s3;
+// see the OnDeleteError of S3OffloadConfig.
 func DeleteMessage(queueUrl string, receiptHandle string) error {
 	SQSclient := sqs.New(sessionutils.Session)
 
 	_, err := SQSclient.DeleteMessage(&sqs.DeleteMessageInput{
 		QueueUrl:      &queueUrl,
-		ReceiptHandle: &receiptHandle,
+		ReceiptHandle: aws.String(sqsReceiptHandle(receiptHandle)),
 	})
 
 	if err != nil {
@@ -108,5 +114,7 @@ func DeleteMessage(queueUrl string, receiptHandle string) error {
 		return err
 	}
 
+	deleteOffloadedBody(receiptHandle)
+
 	return nil
-}
\ No newline at end of file
+}
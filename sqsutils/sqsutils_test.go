@@ -0,0 +1,101 @@
+package sqsutils
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/AmeDigital/aws-utils-go/localstack"
+	"github.com/AmeDigital/aws-utils-go/sessionutils"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+var s3Client *s3.S3
+
+// check stops localstack and panics if the error is not nil.
+func check(e error) {
+	if e != nil {
+		localstack.StopLocalstack()
+		panic(e)
+	}
+}
+
+// TestMain roda em volta de cada teste executado. Os testes são executados
+// na invocação de 'm.Run()'
+func TestMain(m *testing.M) {
+	// cria recursos no localstack,
+	err := localstack.StartLocalstack2(localstack.Services.SQS, localstack.Services.S3)
+	check(err)
+
+	// configures the sqs and s3 clients to use localstack; each service has its own port
+	resolver := endpoints.ResolverFunc(func(service, region string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+		switch service {
+		case endpoints.SqsServiceID:
+			return endpoints.ResolvedEndpoint{URL: localstack.Services.SQS.EndpointUrl(), SigningRegion: region}, nil
+		case endpoints.S3ServiceID:
+			return endpoints.ResolvedEndpoint{URL: localstack.Services.S3.EndpointUrl(), SigningRegion: region}, nil
+		}
+		return endpoints.DefaultResolver().EndpointFor(service, region, opts...)
+	})
+
+	awsConfig := aws.Config{EndpointResolver: resolver, Region: aws.String("us-east-1"), S3ForcePathStyle: aws.Bool(true)}
+	sessionForLocalstack, err := session.NewSession(&awsConfig)
+	sessionutils.Session = sessionForLocalstack
+	check(err)
+	s3Client = s3.New(sessionForLocalstack)
+
+	// executa os testes
+	returnCode := m.Run()
+
+	// desliga o localstack
+	localstack.StopLocalstack()
+
+	os.Exit(returnCode)
+}
+
+// createQueue creates a queue for a test. Use 'defer DeleteQueue(queueUrl)' to remove it.
+func createQueue(queueName string, attributes QueueAttributes) string {
+	queueUrl, err := CreateQueue(queueName, attributes)
+	check(err)
+	return queueUrl
+}
+
+// readMessages reads the messages of a queue until 'count' messages are read or the timeout passes.
+func readMessages(queueUrl string, count int, timeout time.Duration) []*sqs.Message {
+	messages := []*sqs.Message{}
+
+	for deadline := time.Now().Add(timeout); len(messages) < count && time.Now().Before(deadline); {
+		read, err := ReadMessage(queueUrl, 10)
+		check(err)
+		messages = append(messages, read...)
+		if len(read) == 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	return messages
+}
+
+// runConsumer runs a consumer until 'done' returns true, or for 30 seconds.
+func runConsumer(consumer *Consumer, done func() bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		consumer.Run(ctx)
+	}()
+
+	for deadline := time.Now().Add(30 * time.Second); !done() && time.Now().Before(deadline); {
+		time.Sleep(100 * time.Millisecond)
+	}
+	cancel()
+
+	<-stopped
+}